@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
 )
@@ -33,6 +34,83 @@ type Config struct {
 
 	// IngressAnnotations Default annotations to add to all ingresses
 	IngressAnnotations map[string]string `json:"ingressAnnotations,omitempty"`
+
+	// TopologySpread Default policy for spreading the pods of apps with more than one replica
+	TopologySpread TopologySpreadConfig `json:"topologySpread,omitempty"`
+
+	// SecurityBaseline Default security settings applied to all apps, unless an app opts out
+	SecurityBaseline SecurityBaselineConfig `json:"securityBaseline,omitempty"`
+
+	// AllowedRegistries Registries apps may run images from, such as "ghcr.io" or "registry.example.com/team"
+	// An entry with a path only allows the repositories under that path. Images without a registry are from docker.io
+	// Apps with images from other registries get the UnapprovedRegistry condition. All registries are allowed if empty
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// EnforceAllowedRegistries Stops the operator from updating the resources of apps with images from registries
+	// that aren't allowed, instead of only flagging them
+	EnforceAllowedRegistries bool `json:"enforceAllowedRegistries,omitempty"`
+
+	// GlobalImagePullSecrets Image pull secrets copied into the namespace of every app and used by all app pods
+	// Changes to the secrets are copied straight away, except for secrets added after the operator started, which are copied when each app is next reconciled
+	GlobalImagePullSecrets []GlobalImagePullSecret `json:"globalImagePullSecrets,omitempty"`
+
+	// RegistryMirrors Rules that rewrite the images of app pods to pull from a mirror, such as a pull-through cache
+	// The first rule that matches an image is used
+	RegistryMirrors []RegistryMirror `json:"registryMirrors,omitempty"`
+}
+
+// TopologySpreadConfig defines the default spread of app pods across zones and nodes
+// Apps that set their own topologySpreadConstraints are not affected
+type TopologySpreadConfig struct {
+	// Enabled sets whether apps with more than one replica are spread across zones and nodes by default
+	// The replicas set by an app's active scale window count
+	Enabled bool `json:"enabled,omitempty"`
+
+	// MaxSkew the maximum difference in the number of pods between any two zones, or any two nodes
+	// Defaults to 1
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+
+	// WhenUnsatisfiable how to handle a pod that can't be scheduled without exceeding MaxSkew
+	// Defaults to ScheduleAnyway
+	WhenUnsatisfiable corev1.UnsatisfiableConstraintAction `json:"whenUnsatisfiable,omitempty"`
+}
+
+// SecurityBaselineConfig defines the hardened security settings applied to app pods
+// Security context fields set on an app take precedence over the baseline
+type SecurityBaselineConfig struct {
+	// RunAsNonRoot requires the app's containers to run as a non-root user
+	RunAsNonRoot bool `json:"runAsNonRoot,omitempty"`
+
+	// ReadOnlyRootFilesystem mounts the app container's root filesystem as read-only
+	// An emptyDir is mounted at /tmp so apps still have a writable path, unless the app already mounts a volume or file there
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+
+	// DropAllCapabilities drops all linux capabilities from the app's container
+	DropAllCapabilities bool `json:"dropAllCapabilities,omitempty"`
+
+	// SeccompRuntimeDefault uses the container runtime's default seccomp profile for the app's pods
+	SeccompRuntimeDefault bool `json:"seccompRuntimeDefault,omitempty"`
+}
+
+// GlobalImagePullSecret references an image pull secret to copy into the namespace of every app
+// The copy has the same name as the source secret
+type GlobalImagePullSecret struct {
+	// Namespace the namespace of the source secret
+	Namespace string `json:"namespace"`
+
+	// Name the name of the source secret
+	Name string `json:"name"`
+}
+
+// RegistryMirror rewrites images from a registry to pull from a mirror
+type RegistryMirror struct {
+	// Registry the registry to mirror, such as "docker.io", or a path in the registry, such as "ghcr.io/org"
+	// Images without a registry are from docker.io, and official images are in docker.io/library
+	Registry string `json:"registry"`
+
+	// Mirror the registry and optional path the images are pulled from instead, such as "mirror.example.com/dockerhub"
+	// The rest of the repository is kept, so docker.io/library/nginx is pulled from mirror.example.com/dockerhub/library/nginx
+	Mirror string `json:"mirror"`
 }
 
 func init() {
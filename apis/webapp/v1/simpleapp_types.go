@@ -17,7 +17,10 @@ limitations under the License.
 package v1
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -26,57 +29,707 @@ import (
 
 // SimpleAppSpec defines the desired state of SimpleApp
 type SimpleAppSpec struct {
+	// ClassName the cluster-scoped SimpleAppClass the app takes defaults from
+	// The config's defaults apply first, then the namespace's SimpleAppDefaults, then the class's, then the app's own fields
+	ClassName string `json:"className,omitempty"`
+
 	// Image is the container image to deploy
 	Image string `json:"image,omitempty"`
 
 	// ImagePullPolicy describes a policy for if/when to pull a container image
-	// +kubebuilder:default:="IfNotPresent"
+	// Defaults to IfNotPresent
 	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
 
 	// ImagePullSecrets names of the secrets with image pull credentials
 	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
 
+	// ImagePolicy rolls the app forward to the newest tag of the image's repository that matches the policy
+	// The registry is queried with the ImagePullSecrets, and the tag of Image is used until a tag is resolved
+	ImagePolicy *ImagePolicySpec `json:"imagePolicy,omitempty"`
+
+	// PinImageDigest resolves the image's tag to a digest, and runs the image by digest, so a rollout's pods all run the same image
+	// The tag is resolved once for each image, so a tag that is pushed again is only picked up when the image changes
+	// Until the tag resolves, the image runs by tag, and failures are retried with backoff
+	PinImageDigest bool `json:"pinImageDigest,omitempty"`
+
+	// Command overrides the image's entrypoint
+	// $(VAR_NAME) references are expanded using the container's environment variables
+	Command []string `json:"command,omitempty"`
+
+	// Args overrides the image's cmd
+	// $(VAR_NAME) references are expanded using the container's environment variables
+	Args []string `json:"args,omitempty"`
+
+	// WorkingDir overrides the image's working directory
+	// $(VAR_NAME) references are expanded using the values of the app's environment variables
+	WorkingDir string `json:"workingDir,omitempty"`
+
+	// Env environment variables to set in the app's container
+	// Init containers and sidecars share these environment variables
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom sources of environment variables, such as config maps and secrets, for the app's container
+	// Init containers and sidecars share these sources
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Resources compute resources required by the app's container
+	// If empty, the resources from the namespace's SimpleAppDefaults are used
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
 	// @TODO LivenessProbe
 	// @TODO ReadinessProbe
 
 	// ContainerPort is the port the container is set to listen on
-	// +kubebuilder:default:=80
+	// Defaults to 80
 	ContainerPort int32 `json:"containerPort,omitempty"`
 
 	// Replicas how many replicas in the deployment
-	// +kubebuilder:default:=1
+	// Defaults to 1
 	Replicas *int32 `json:"replicas,omitempty"`
 
+	// WorkloadKind the kind of workload that runs the app's pods
+	// StatefulSet gives each replica a stable identity and its own copy of the app's volumes, with a headless service named <app>-headless
+	// When switching, the service moves to the new workload's pods once they're ready, and the old workload is then removed
+	// The pods of each kind have the workload label webapp.k8s.cmm.io/workload: <kind>. Volume data isn't migrated between kinds
+	// Blue/green deployments and AutoRollback are not supported for StatefulSets
+	// Defaults to Deployment
+	// +kubebuilder:validation:Enum=Deployment;StatefulSet
+	WorkloadKind WorkloadKind `json:"workloadKind,omitempty"`
+
+	// Suspend stops the operator from creating, updating or deleting any of the app's resources, while still reporting status
+	// Useful for editing the app's resources by hand during incidents
+	// Setting the webapp.k8s.cmm.io/paused annotation to "true" has the same effect
+	Suspend bool `json:"suspend,omitempty"`
+
+	// ScaleToZero scales the app's workloads to zero replicas and suspends its cron jobs, without deleting the service or ingress
+	ScaleToZero bool `json:"scaleToZero,omitempty"`
+
+	// RestartedAt restarts the app's pods when changed, like kubectl rollout restart
+	// The value is added to the pod template, so set it to the current time to restart
+	// Restarts also apply to workloads that keep their pod template, such as the active blue/green colour, without rolling out other changes
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+
+	// RestartSchedule restarts the app's pods on a cron schedule, such as "0 4 * * *"
+	// Prefix the schedule with CRON_TZ=<timezone> to use a timezone other than UTC
+	// An invalid schedule is reported with the InvalidRestartSchedule condition
+	RestartSchedule string `json:"restartSchedule,omitempty"`
+
+	// ScaleSchedule windows of time in which the app runs a different number of replicas
+	// If windows overlap, the first active window in the list is used
+	// Outside of all windows, the app runs Replicas
+	// Window names must be unique
+	// Windows with invalid schedules, and windows with the name of an earlier window, are skipped, and reported with the InvalidScaleSchedule condition
+	ScaleSchedule []ScaleWindow `json:"scaleSchedule,omitempty"`
+
 	// ServiceEnabled sets whether an ingress should be enabled
-	// +kubebuilder:default:=true
+	// Defaults to true
 	ServiceEnabled bool `json:"serviceEnabled,omitempty"`
 
 	// ServicePort is the port the service will listen on
 	// traffic will be forwarded at the service to the ContainerPort
-	// +kubebuilder:default:=80
+	// Defaults to 80
 	ServicePort int32 `json:"servicePort,omitempty"`
 
 	// IngressEnabled sets whether an ingress should be enabled
-	// +kubebuilder:default:=true
+	// Defaults to true
 	IngressEnabled bool `json:"ingressEnabled,omitempty"`
 
 	// Hostname is the hostname to use for the Ingress
+	// If empty, the hostname suffix from the namespace's SimpleAppDefaults gives <app name>.<suffix>
 	Hostname string `json:"hostname,omitempty"`
 
 	// IngressPaths are the paths the ingress will serve traffic on
-	// The default below looks like an object, but it's actually an array in kubebuilder syntax
-	// +kubebuilder:default:={"/"}
+	// Defaults to ["/"]
 	IngressPaths []string `json:"ingressPaths,omitempty"`
 
 	// IngressAnnotations map of annotations that should be added to an ingress
 	// If a key is present in this, it will override the global ingress annotation with the same key
 	IngressAnnotations map[string]string `json:"ingressAnnotations,omitempty"`
+
+	// ServiceAccount configures the service account the app's pods run as
+	// If omitted, pods run as the namespace default service account
+	ServiceAccount *ServiceAccountSpec `json:"serviceAccount,omitempty"`
+
+	// NodeSelector map of node labels a node must have for the app's pods to be scheduled on it
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations the app's pods have, allowing them to be scheduled on tainted nodes
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity scheduling constraints for the app's pods
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// TopologySpreadConstraints describe how the app's pods are spread across zones, nodes, etc
+	// If set, the global default topology spread from the config is not applied
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// PriorityClassName the priority class of the app's pods
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// PodSecurityContext pod level security attributes
+	// Fields set here take precedence over the global security baseline
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// SecurityContext container level security attributes
+	// Fields set here take precedence over the global security baseline
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// DisableSecurityBaseline opts the app out of the global security baseline from the config
+	DisableSecurityBaseline bool `json:"disableSecurityBaseline,omitempty"`
+
+	// Volumes persistent volume claims the operator creates and mounts into the app's container
+	// In StatefulSet mode, each replica gets its own claims from the stateful set's volume claim templates,
+	// and the volumes are only mounted in the stateful set's pods
+	Volumes []VolumeSpec `json:"volumes,omitempty"`
+
+	// Files map of file paths to file contents that are mounted into the app's container
+	// Changing the contents of a file rolls the deployment
+	Files map[string]string `json:"files,omitempty"`
+
+	// InitContainers run to completion, in order, before the app's container starts
+	// Useful for migrations or waiting on dependencies
+	// They don't run in the jobs of hooks, cron jobs or tasks
+	InitContainers []ContainerSpec `json:"initContainers,omitempty"`
+
+	// Sidecars run alongside the app's container in the same pod
+	// Useful for log shippers or proxies
+	Sidecars []ContainerSpec `json:"sidecars,omitempty"`
+
+	// Strategy the deployment strategy used to replace old pods with new ones
+	Strategy *appsv1.DeploymentStrategy `json:"strategy,omitempty"`
+
+	// MinReadySeconds how long a new pod must be ready, without crashing, before it is considered available
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+
+	// ProgressDeadlineSeconds how long a rollout can make no progress before it is considered failed
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+
+	// RevisionHistoryLimit how many old replica sets to keep to allow rollback
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// TerminationGracePeriodSeconds how long pods have to shut down after SIGTERM before they are killed
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// AutoRollback reverts the deployment to the last revision that rolled out successfully when a rollout fails
+	// A rollout fails when it makes no progress for ProgressDeadlineSeconds
+	// The app stays on the reverted revision until the app is changed again
+	AutoRollback bool `json:"autoRollback,omitempty"`
+
+	// PreStop handler called in the app's container before it is sent SIGTERM
+	// Takes precedence over GracefulShutdown
+	PreStop *corev1.Handler `json:"preStop,omitempty"`
+
+	// GracefulShutdown adds a preStop sleep to the app's container, so endpoints are removed from the service
+	// and ingress before the container receives SIGTERM
+	GracefulShutdown *GracefulShutdownSpec `json:"gracefulShutdown,omitempty"`
+
+	// Canary runs a new image alongside the app and sends a slice of the ingress traffic to it
+	// Requires the ingress to be enabled, and an ingress controller that supports nginx canary annotations
+	Canary *CanarySpec `json:"canary,omitempty"`
+
+	// BlueGreen runs the app as two deployment colours, with the hostname routed to the active colour
+	// and the inactive colour exposed on a preview hostname
+	// Changes to the app are rolled out to the inactive colour, and go live when the active colour is switched
+	// Canary releases are not supported in blue/green mode
+	BlueGreen *BlueGreenSpec `json:"blueGreen,omitempty"`
+
+	// Hooks commands that run in jobs at points in the app's lifecycle
+	Hooks *HooksSpec `json:"hooks,omitempty"`
+
+	// CronJobs commands that run on a schedule in jobs with the app's image, env, secrets and volumes
+	// +listType=map
+	// +listMapKey=name
+	CronJobs []CronJobSpec `json:"cronJobs,omitempty"`
+
+	// Processes background processes, such as queue workers, that run from the app's image alongside the web process
+	// Each process runs in its own deployment, keyed by the process name, with no service or ingress
+	// The deployments are named <app>-process-<name>, and their pods have the app's name label and the process label webapp.k8s.cmm.io/process: <name>
+	// The app's service selects its web pods by the workload label webapp.k8s.cmm.io/workload, which process pods don't have
+	Processes map[string]ProcessSpec `json:"processes,omitempty"`
+}
+
+// CronJobSpec defines a command that runs on a schedule
+// The app's init containers and sidecars don't run in the cron job's pods
+// Runs use the app's image, and only switch to a new image once the pre deploy hook succeeded for it
+type CronJobSpec struct {
+	// Name of the cron job, the cron job is named <app>-cron-<name>
+	Name string `json:"name"`
+
+	// Schedule cron schedule for when the command runs, such as "0 3 * * *"
+	Schedule string `json:"schedule"`
+
+	// Command to run, overrides the image's entrypoint
+	Command []string `json:"command,omitempty"`
+
+	// Args for the command
+	Args []string `json:"args,omitempty"`
+
+	// ConcurrencyPolicy how to treat a run that is due while the previous run is still going
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	// +kubebuilder:default:=Forbid
+	ConcurrencyPolicy batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Suspend stops future runs, without affecting runs that already started
+	Suspend bool `json:"suspend,omitempty"`
+
+	// BackoffLimit how many times a run is retried before it fails
+	// +kubebuilder:default:=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds how long a run may take before it fails
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// ProcessSpec defines a background process that runs in its own deployment
+// The process shares the app's image, env, secrets and volumes
+type ProcessSpec struct {
+	// Command to run, overrides the image's entrypoint
+	Command []string `json:"command,omitempty"`
+
+	// Args for the command
+	Args []string `json:"args,omitempty"`
+
+	// Replicas how many replicas of the process run
+	// +kubebuilder:default:=1
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Resources compute resources required by the process's container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// HooksSpec defines the commands that run in jobs at points in the app's lifecycle
+type HooksSpec struct {
+	// PreDeploy runs when the app's image changes, such as to migrate a database
+	// The app's init containers don't run before it, so a migration done by an init container should move here
+	// The new image is not deployed until the hook succeeds, and a failed hook blocks the rollout
+	PreDeploy *HookSpec `json:"preDeploy,omitempty"`
+}
+
+// HookSpec defines a command that runs in a job with the app's image, env, secrets and volumes
+// The app's init containers and sidecars don't run in the hook's pod
+type HookSpec struct {
+	// Command to run, overrides the image's entrypoint
+	Command []string `json:"command,omitempty"`
+
+	// Args for the command
+	Args []string `json:"args,omitempty"`
+
+	// BackoffLimit how many times the hook is retried before it fails
+	// +kubebuilder:default:=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds how long the hook may run before it fails
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// GracefulShutdownSpec defines a delay before the app's container is sent SIGTERM
+type GracefulShutdownSpec struct {
+	// DelaySeconds how long the preStop hook sleeps for
+	// The image must provide a sleep binary
+	// If TerminationGracePeriodSeconds is not set, it is set to this delay plus the kubernetes default of 30 seconds
+	// +kubebuilder:default:=10
+	DelaySeconds int64 `json:"delaySeconds,omitempty"`
+}
+
+// ImagePolicySpec defines which tags of the image's repository the app is rolled forward to
+// At least one of Semver or Pattern must be set, and tags must match both if both are set
+type ImagePolicySpec struct {
+	// Semver range of versions to roll forward to, such as ">=1.2.0 <2.0.0" or "~1.4"
+	// Tags that aren't semantic versions are ignored, and the highest matching version is used
+	Semver string `json:"semver,omitempty"`
+
+	// Pattern regular expression tags must match, such as "^main-[0-9]+$"
+	// Without Semver, matching tags are ordered by the pattern's first capture group, or else the whole tag,
+	// numerically if they are numbers and alphabetically otherwise, and the last tag is used
+	Pattern string `json:"pattern,omitempty"`
+
+	// IntervalSeconds how often the registry is queried for new tags
+	// +kubebuilder:validation:Minimum=30
+	// +kubebuilder:default:=300
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// WorkloadKind is the kind of workload that runs the app's pods
+type WorkloadKind string
+
+const (
+	// WorkloadKindDeployment runs the app's pods in a deployment
+	WorkloadKindDeployment WorkloadKind = "Deployment"
+
+	// WorkloadKindStatefulSet runs the app's pods in a stateful set
+	WorkloadKindStatefulSet WorkloadKind = "StatefulSet"
+)
+
+// ScaleWindow defines a window of time in which the app runs a different number of replicas
+type ScaleWindow struct {
+	// Name of the window, shown in status while the window is active
+	// Must be unique within the app's scale schedule
+	Name string `json:"name"`
+
+	// Start cron schedule for when the window starts, such as "0 8 * * 1-5"
+	// Prefix the schedule with CRON_TZ=<timezone> to use a timezone other than UTC
+	Start string `json:"start"`
+
+	// End cron schedule for when the window ends, such as "0 18 * * 1-5"
+	// Prefix the schedule with CRON_TZ=<timezone> to use a timezone other than UTC
+	End string `json:"end"`
+
+	// Replicas how many replicas the app runs during the window
+	Replicas int32 `json:"replicas"`
+}
+
+// ContainerSpec defines an additional container in the app's pods
+// The container shares the app's environment variables and volume mounts
+type ContainerSpec struct {
+	// Name of the container
+	Name string `json:"name"`
+
+	// Image is the container image to run
+	// Defaults to the app's image
+	Image string `json:"image,omitempty"`
+
+	// Command overrides the image's entrypoint
+	Command []string `json:"command,omitempty"`
+
+	// Args overrides the image's cmd
+	Args []string `json:"args,omitempty"`
+
+	// Env environment variables to set in addition to the app's environment variables
+	// If a name is present in this, it will override the app's environment variable with the same name
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Ports the container listens on
+	Ports []corev1.ContainerPort `json:"ports,omitempty"`
+
+	// Resources compute resources required by the container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// ServiceAccountSpec defines the service account used by the app's pods
+type ServiceAccountSpec struct {
+	// Create sets whether the operator should create a dedicated service account for the app
+	// The created service account is named after the app
+	Create bool `json:"create,omitempty"`
+
+	// Name of an existing service account to use
+	// Ignored when Create is true
+	Name string `json:"name,omitempty"`
+
+	// Annotations map of annotations to add to the created service account
+	// Useful for cloud workload identity, such as eks.amazonaws.com/role-arn or iam.gke.io/gcp-service-account
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// AutomountServiceAccountToken sets whether the service account token is mounted into the app's pods
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+}
+
+// VolumeSpec defines a persistent volume claim for the app
+type VolumeSpec struct {
+	// Name of the volume
+	// The persistent volume claim is named <app name>-<volume name>
+	Name string `json:"name"`
+
+	// MountPath is the path in the container the volume is mounted at
+	MountPath string `json:"mountPath"`
+
+	// Size of the volume, such as 10Gi
+	// The size can be increased later if the storage class allows volume expansion
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName the storage class of the volume
+	// If omitted, the cluster default storage class is used
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessModes the access modes of the volume
+	// The default below looks like an object, but it's actually an array in kubebuilder syntax
+	// +kubebuilder:default:={"ReadWriteOnce"}
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// RetainOnDelete keeps the persistent volume claim when the volume or the SimpleApp is deleted
+	// Retained claims are not owned by the SimpleApp, so they are never garbage collected
+	// +kubebuilder:default:=true
+	RetainOnDelete *bool `json:"retainOnDelete,omitempty"`
+}
+
+// CanaryAction is an action taken on a running canary
+// +kubebuilder:validation:Enum=Promote;Abort
+type CanaryAction string
+
+const (
+	// CanaryActionPromote runs the canary image in the app's deployment and removes the canary
+	CanaryActionPromote CanaryAction = "Promote"
+
+	// CanaryActionAbort removes the canary, leaving the app's deployment on its current image
+	CanaryActionAbort CanaryAction = "Abort"
+)
+
+// CanarySpec defines a canary release of a new image
+type CanarySpec struct {
+	// Image is the container image to run in the canary
+	Image string `json:"image"`
+
+	// Weight is the percentage of requests that are sent to the canary
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight,omitempty"`
+
+	// Header name of a request header that routes requests to the canary, regardless of the weight
+	// Requests are routed to the canary when the header is "always", or equals HeaderValue if set
+	Header string `json:"header,omitempty"`
+
+	// HeaderValue the value of Header that routes requests to the canary
+	HeaderValue string `json:"headerValue,omitempty"`
+
+	// Cookie name of a cookie that routes requests to the canary when its value is "always", regardless of the weight
+	Cookie string `json:"cookie,omitempty"`
+
+	// Replicas how many replicas in the canary deployment
+	// +kubebuilder:default:=1
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Action promotes or aborts the canary
+	// Once promoted, the canary image runs in the app's deployment until the app's image is updated and the canary removed
+	Action CanaryAction `json:"action,omitempty"`
+}
+
+// CanaryPhase is the state of a canary release
+type CanaryPhase string
+
+const (
+	// CanaryPhaseProgressing the canary deployment is rolling out
+	CanaryPhaseProgressing CanaryPhase = "Progressing"
+
+	// CanaryPhaseReady all canary replicas are ready and receiving traffic
+	CanaryPhaseReady CanaryPhase = "Ready"
+
+	// CanaryPhasePromoted the canary image runs in the app's deployment
+	CanaryPhasePromoted CanaryPhase = "Promoted"
+
+	// CanaryPhaseAborted the canary was removed without being promoted
+	CanaryPhaseAborted CanaryPhase = "Aborted"
+
+	// CanaryPhaseInactive the canary can't run, see the status message
+	CanaryPhaseInactive CanaryPhase = "Inactive"
+)
+
+// CanaryStatus defines the observed state of a canary release
+type CanaryStatus struct {
+	// Phase the state of the canary
+	Phase CanaryPhase `json:"phase,omitempty"`
+
+	// Image the canary image
+	Image string `json:"image,omitempty"`
+
+	// Weight the percentage of requests sent to the canary
+	Weight int32 `json:"weight,omitempty"`
+
+	// ReadyReplicas how many canary replicas are ready
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Message a human readable explanation of the phase
+	Message string `json:"message,omitempty"`
+}
+
+// Color is a blue/green deployment colour
+// +kubebuilder:validation:Enum=blue;green
+type Color string
+
+const (
+	// ColorBlue the blue deployment colour
+	ColorBlue Color = "blue"
+
+	// ColorGreen the green deployment colour
+	ColorGreen Color = "green"
+)
+
+// BlueGreenSpec defines a blue/green deployment of the app
+type BlueGreenSpec struct {
+	// ActiveColor the colour that receives traffic on the app's hostname
+	// Switching back to the previous colour is an instant rollback, as long as no new changes were made to the app
+	// Ignored when AutoPromote is true
+	// +kubebuilder:default:="blue"
+	ActiveColor Color `json:"activeColor,omitempty"`
+
+	// AutoPromote switches the active colour as soon as the inactive colour runs the latest changes and all of its
+	// replicas are ready
+	// The active colour is then tracked in status. Set this to false and ActiveColor to the desired colour to roll back
+	AutoPromote bool `json:"autoPromote,omitempty"`
+
+	// PreviewHostname is the hostname the inactive colour is exposed on
+	// Defaults to preview-<hostname>
+	PreviewHostname string `json:"previewHostname,omitempty"`
+}
+
+// BlueGreenStatus defines the observed state of a blue/green deployment
+type BlueGreenStatus struct {
+	// ActiveColor the colour that receives traffic on the app's hostname
+	// Empty while migrating from a single deployment, until the active colour is ready
+	ActiveColor Color `json:"activeColor,omitempty"`
+
+	// PreviewColor the colour exposed on the preview hostname
+	PreviewColor Color `json:"previewColor,omitempty"`
+
+	// ActiveImage the image running in the active colour
+	ActiveImage string `json:"activeImage,omitempty"`
+
+	// PreviewImage the image running in the preview colour
+	PreviewImage string `json:"previewImage,omitempty"`
+
+	// PreviewReady whether all of the preview colour's replicas are ready
+	PreviewReady bool `json:"previewReady,omitempty"`
+
+	// PreviewUpToDate whether the preview colour runs the latest changes to the app
+	PreviewUpToDate bool `json:"previewUpToDate,omitempty"`
+}
+
+// RolloutStatus defines the observed state of the app's deployment rollouts
+type RolloutStatus struct {
+	// LastKnownGoodRevision the deployment revision that last rolled out successfully
+	LastKnownGoodRevision string `json:"lastKnownGoodRevision,omitempty"`
+
+	// LastKnownGoodImage the image of the revision that last rolled out successfully
+	LastKnownGoodImage string `json:"lastKnownGoodImage,omitempty"`
+
+	// FailedImage the image of the rollout that failed
+	FailedImage string `json:"failedImage,omitempty"`
+
+	// FailedTemplateHash identifies the version of the app that failed to roll out
+	FailedTemplateHash string `json:"failedTemplateHash,omitempty"`
+
+	// RolledBack whether the deployment was reverted to the last known good revision
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// JobPhase is the state of a job run by a hook or cron job
+type JobPhase string
+
+const (
+	// JobPhasePending the job hasn't started, see the status message
+	JobPhasePending JobPhase = "Pending"
+
+	// JobPhaseRunning the job is running
+	JobPhaseRunning JobPhase = "Running"
+
+	// JobPhaseSucceeded the job completed successfully
+	JobPhaseSucceeded JobPhase = "Succeeded"
+
+	// JobPhaseFailed the job failed, see the status message
+	JobPhaseFailed JobPhase = "Failed"
+)
+
+// HookStatus defines the observed state of a hook
+type HookStatus struct {
+	// Phase the state of the hook
+	Phase JobPhase `json:"phase,omitempty"`
+
+	// Image the image the hook ran for
+	Image string `json:"image,omitempty"`
+
+	// JobName the name of the hook's job
+	JobName string `json:"jobName,omitempty"`
+
+	// Message details about the hook's state
+	Message string `json:"message,omitempty"`
+}
+
+// ImagePolicyStatus defines the observed state of the image policy
+type ImagePolicyStatus struct {
+	// Image the image the policy resolved to, which the app runs
+	Image string `json:"image,omitempty"`
+
+	// Digest the digest of the resolved image
+	Digest string `json:"digest,omitempty"`
+
+	// LastChecked when the registry was last queried
+	LastChecked *metav1.Time `json:"lastChecked,omitempty"`
+
+	// ObservedGeneration the generation of the app the policy was last resolved for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Failures how many queries in a row failed, the registry is queried less often after each failure
+	Failures int32 `json:"failures,omitempty"`
+
+	// Message details about the last query, such as why it failed
+	Message string `json:"message,omitempty"`
+}
+
+// ImageDigestStatus defines the observed state of image digest pinning
+type ImageDigestStatus struct {
+	// Image the image that was resolved, by tag
+	Image string `json:"image,omitempty"`
+
+	// Digest the digest the image's tag resolved to, which the app runs
+	Digest string `json:"digest,omitempty"`
+
+	// LastChecked when the registry was last queried for the digest
+	LastChecked *metav1.Time `json:"lastChecked,omitempty"`
+
+	// Failures how many attempts in a row failed to resolve the digest, the registry is queried less often after each failure
+	Failures int32 `json:"failures,omitempty"`
+
+	// Message details about the last attempt to resolve the digest, such as why it failed
+	Message string `json:"message,omitempty"`
+}
+
+// CronJobStatus defines the observed state of a cron job
+type CronJobStatus struct {
+	// Name of the cron job in the app's spec
+	Name string `json:"name"`
+
+	// LastScheduleTime when the cron job last started a run
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime when a run of the cron job last completed successfully
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// LastJobName the name of the job of the latest run
+	LastJobName string `json:"lastJobName,omitempty"`
+
+	// LastJobPhase the state of the latest run
+	LastJobPhase JobPhase `json:"lastJobPhase,omitempty"`
+
+	// Message details about the latest run
+	Message string `json:"message,omitempty"`
 }
 
 // SimpleAppStatus defines the observed state of SimpleApp
 type SimpleAppStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Conditions the latest observations of the app's state
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Rollout the observed state of the app's deployment rollouts
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// LastScheduledRestart the time of the last restart from the restart schedule
+	LastScheduledRestart *metav1.Time `json:"lastScheduledRestart,omitempty"`
+
+	// NextScheduledRestart the time of the next restart from the restart schedule
+	NextScheduledRestart *metav1.Time `json:"nextScheduledRestart,omitempty"`
+
+	// ImagePolicy the observed state of the image policy, if there is one
+	ImagePolicy *ImagePolicyStatus `json:"imagePolicy,omitempty"`
+
+	// ImageDigest the observed state of image digest pinning, if enabled
+	ImageDigest *ImageDigestStatus `json:"imageDigest,omitempty"`
+
+	// ActiveScaleWindow the name of the scale schedule window that is currently active, if any
+	ActiveScaleWindow string `json:"activeScaleWindow,omitempty"`
+
+	// Canary the observed state of the canary release, if there is one
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// BlueGreen the observed state of the blue/green deployment, if enabled
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+
+	// PreDeployHook the observed state of the pre deploy hook for the app's image, if there is one
+	PreDeployHook *HookStatus `json:"preDeployHook,omitempty"`
+
+	// CronJobs the observed state of the app's cron jobs
+	// +listType=map
+	// +listMapKey=name
+	CronJobs []CronJobStatus `json:"cronJobs,omitempty"`
 }
 
 //+kubebuilder:object:root=true
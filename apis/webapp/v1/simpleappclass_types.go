@@ -0,0 +1,51 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// SimpleAppClass is the Schema for the simpleappclasses API
+// A class is a reusable profile of defaults for the SimpleApps that reference it by className
+type SimpleAppClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec the defaults for the apps of the class, as a partial SimpleApp spec
+	// Fields set on an app take precedence, including false and zero values, maps are merged key by key,
+	// and lists set on an app replace the class's
+	// Fields with defaults, such as containerPort or ingressEnabled, are defaulted after the class is applied, so a class can set them
+	// Apps created before the defaults moved out of the CRD have them stored, and keep their own values until the fields are removed
+	Spec SimpleAppSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SimpleAppClassList contains a list of SimpleAppClass
+type SimpleAppClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SimpleAppClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SimpleAppClass{}, &SimpleAppClassList{})
+}
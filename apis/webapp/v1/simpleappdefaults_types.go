@@ -0,0 +1,65 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SimpleAppDefaultsSpec defines the defaults for the SimpleApps in a namespace
+type SimpleAppDefaultsSpec struct {
+	// IngressAnnotations map of annotations to add to the ingresses of the namespace's apps
+	// These override the config's ingress annotations with the same key, and are overridden by the app's
+	IngressAnnotations map[string]string `json:"ingressAnnotations,omitempty"`
+
+	// Resources compute resources for the containers of the namespace's apps that don't set their own,
+	// including init containers, sidecars and processes
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// HostnameSuffix gives apps without a hostname the hostname <app name>.<suffix>, such as myapp.team.example.com
+	HostnameSuffix string `json:"hostnameSuffix,omitempty"`
+
+	// ImagePullSecrets names of the secrets with image pull credentials, added after the app's own
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=simpleappdefaults
+
+// SimpleAppDefaults is the Schema for the simpleappdefaults API
+// The defaults apply to every SimpleApp in the namespace, after the config's defaults and before the app's class
+// If a namespace has more than one, they are applied in order of name, with later ones taking precedence
+type SimpleAppDefaults struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SimpleAppDefaultsSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SimpleAppDefaultsList contains a list of SimpleAppDefaults
+type SimpleAppDefaultsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SimpleAppDefaults `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SimpleAppDefaults{}, &SimpleAppDefaultsList{})
+}
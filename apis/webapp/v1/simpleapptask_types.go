@@ -0,0 +1,102 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SimpleAppTaskSpec defines the desired state of SimpleAppTask
+type SimpleAppTaskSpec struct {
+	// AppName the name of the SimpleApp in the task's namespace whose image and configuration the command runs with
+	// The app's init containers and sidecars don't run in the task's pod
+	AppName string `json:"appName"`
+
+	// Command to run, overrides the image's entrypoint
+	Command []string `json:"command,omitempty"`
+
+	// Args for the command
+	Args []string `json:"args,omitempty"`
+
+	// BackoffLimit how many times the command is retried before the task fails
+	// +kubebuilder:default:=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds how long the command may run before the task fails
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// TTLSecondsAfterFinished how long the task is kept after it finishes, before it is deleted along with its job
+	// +kubebuilder:default:=86400
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// SimpleAppTaskStatus defines the observed state of SimpleAppTask
+type SimpleAppTaskStatus struct {
+	// Phase the state of the task
+	Phase JobPhase `json:"phase,omitempty"`
+
+	// Image the image the command runs in
+	Image string `json:"image,omitempty"`
+
+	// JobName the name of the task's job
+	JobName string `json:"jobName,omitempty"`
+
+	// PodName the name of the pod of the latest attempt to run the command
+	PodName string `json:"podName,omitempty"`
+
+	// ExitCode the exit code of the command in the latest attempt, once it exited
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// StartTime when the task's job was created
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime when the task succeeded or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Message details about the task's state
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="App",type=string,JSONPath=`.spec.appName`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Exit Code",type=integer,JSONPath=`.status.exitCode`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SimpleAppTask is the Schema for the simpleapptasks API
+// A task runs a one-off command with the image and configuration of a SimpleApp
+type SimpleAppTask struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SimpleAppTaskSpec   `json:"spec,omitempty"`
+	Status SimpleAppTaskStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SimpleAppTaskList contains a list of SimpleAppTask
+type SimpleAppTaskList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SimpleAppTask `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SimpleAppTask{}, &SimpleAppTaskList{})
+}
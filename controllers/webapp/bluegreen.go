@@ -0,0 +1,359 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	util "github.com/cmmarslender/web-operator/pkg"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var colors = []webappv1.Color{webappv1.ColorBlue, webappv1.ColorGreen}
+
+// ReconcileBlueGreen ensures the blue and green deployments and the preview service and ingress exist in blue/green mode,
+// and records the observed state in the app's status
+// Outside of blue/green mode, the colour resources are removed once the app's workload is ready
+func (r *SimpleAppReconciler) ReconcileBlueGreen(ctx context.Context, app *webappv1.SimpleApp) (*reconcile.Result, error) {
+	if !blueGreenEnabled(*app) {
+		app.Status.BlueGreen = nil
+		return r.removeBlueGreen(ctx, *app)
+	}
+
+	primary, err := r.getDeployment(ctx, app.Namespace, app.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	statefulSet, err := r.getStatefulSet(ctx, app.Namespace, app.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	blueGreen := app.Spec.BlueGreen
+
+	current := map[webappv1.Color]*appsv1.Deployment{}
+	for _, color := range colors {
+		current[color], err = r.getDeployment(ctx, app.Namespace, r.colorObjectMeta(*app, color).Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The hash of the latest pod template, without the colour label, to tell which colours run the latest changes
+	desiredApp := r.primaryApp(*app)
+	latestHash, err := templateHash(r.deploymentObject(desiredApp, r.getObjectMeta(*app)).Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	active := r.activeColor(*app)
+	preview := otherColor(active)
+
+	// Auto promote once the preview colour runs the latest changes and is ready
+	if blueGreen.AutoPromote && current[preview] != nil && deploymentReady(*current[preview]) &&
+		current[preview].Annotations[templateHashAnnotationKey] == latestHash &&
+		(current[active] == nil || current[active].Annotations[templateHashAnnotationKey] != latestHash) {
+		active, preview = preview, active
+	}
+
+	activeHash := ""
+	if current[active] != nil {
+		activeHash = current[active].Annotations[templateHashAnnotationKey]
+	}
+
+	desired := map[webappv1.Color]*appsv1.Deployment{}
+	for _, color := range []webappv1.Color{active, preview} {
+		desired[color] = r.deploymentObject(desiredApp, r.colorObjectMeta(*app, color))
+		desired[color].Annotations = map[string]string{templateHashAnnotationKey: latestHash}
+
+		// The active colour keeps running what it runs, so switching colours is an instant rollback
+		// The preview colour picks up new changes, but is left alone if the active colour already runs them
+		state := reconciler.DesiredState(reconciler.StatePresent)
+		if color == active || activeHash == latestHash {
+			state = reconciler.DynamicDesiredState{BeforeUpdateFunc: keepDeploymentTemplate}
+		}
+		if preDeployHookPending(*app) {
+			state = preDeployHookState(keepDeploymentTemplate)
+		}
+
+		result, err := r.ReconcileResource(*app, desired[color], state)
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	status := &webappv1.BlueGreenStatus{
+		PreviewColor:    preview,
+		ActiveImage:     desired[active].Spec.Template.Spec.Containers[0].Image,
+		PreviewImage:    desired[preview].Spec.Template.Spec.Containers[0].Image,
+		PreviewReady:    current[preview] != nil && deploymentReady(*current[preview]),
+		PreviewUpToDate: desired[preview].Annotations[templateHashAnnotationKey] == latestHash,
+	}
+
+	// Keep the app's deployment or stateful set serving traffic until the active colour is ready to take over
+	// The stateful set is removed by ReconcileStatefulSet
+	if primary != nil || statefulSet != nil {
+		if primary != nil && current[active] != nil && deploymentReady(*current[active]) {
+			result, err := r.ReconcileResource(*app, r.deploymentObject(*app, r.getObjectMeta(*app)), reconciler.StateAbsent)
+			if result != nil || err != nil {
+				return result, err
+			}
+		}
+	} else {
+		status.ActiveColor = active
+	}
+	app.Status.BlueGreen = status
+
+	previewMeta := r.previewObjectMeta(*app, preview)
+	result, err := r.ReconcileResource(*app, r.serviceObject(*app, previewMeta), util.ReconcilerStateHelper(app.Spec.ServiceEnabled))
+	if result != nil || err != nil {
+		return result, err
+	}
+
+	return r.ReconcileResource(*app, r.previewIngressObject(*app, previewMeta), util.ReconcilerStateHelper(app.Spec.IngressEnabled))
+}
+
+// blueGreenStatus returns the observed state of the colour deployments, without promoting or updating them
+// It's used while the app is suspended, so the active colour is kept as it is
+func (r *SimpleAppReconciler) blueGreenStatus(ctx context.Context, app webappv1.SimpleApp) (*webappv1.BlueGreenStatus, error) {
+	if !blueGreenEnabled(app) || app.Status.BlueGreen == nil {
+		return app.Status.BlueGreen, nil
+	}
+
+	latestHash, err := templateHash(r.deploymentObject(r.primaryApp(app), r.getObjectMeta(app)).Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	status := app.Status.BlueGreen.DeepCopy()
+	status.PreviewColor = otherColor(r.activeColor(app))
+
+	active, err := r.getDeployment(ctx, app.Namespace, r.colorObjectMeta(app, r.activeColor(app)).Name)
+	if err != nil {
+		return nil, err
+	}
+	status.ActiveImage = ""
+	if active != nil {
+		status.ActiveImage = deploymentImage(*active)
+	}
+
+	preview, err := r.getDeployment(ctx, app.Namespace, r.colorObjectMeta(app, status.PreviewColor).Name)
+	if err != nil {
+		return nil, err
+	}
+	status.PreviewImage = ""
+	status.PreviewReady = false
+	status.PreviewUpToDate = false
+	if preview != nil {
+		status.PreviewImage = deploymentImage(*preview)
+		status.PreviewReady = deploymentReady(*preview)
+		status.PreviewUpToDate = preview.Annotations[templateHashAnnotationKey] == latestHash
+	}
+
+	return status, nil
+}
+
+// removeBlueGreen removes the preview service and ingress, and the colour deployments once the app's workload is ready
+func (r *SimpleAppReconciler) removeBlueGreen(ctx context.Context, app webappv1.SimpleApp) (*reconcile.Result, error) {
+	previewMeta := r.previewObjectMeta(app, webappv1.ColorGreen)
+	result, err := r.ReconcileResource(app, r.previewIngressObject(app, previewMeta), reconciler.StateAbsent)
+	if result != nil || err != nil {
+		return result, err
+	}
+
+	result, err = r.ReconcileResource(app, r.serviceObject(app, previewMeta), reconciler.StateAbsent)
+	if result != nil || err != nil {
+		return result, err
+	}
+
+	// The app's service selects the colour pods too, so they keep serving traffic until the app's workload is ready
+	ready, err := r.workloadReady(ctx, app)
+	if err != nil || !ready {
+		return nil, err
+	}
+
+	for _, color := range colors {
+		result, err := r.ReconcileResource(app, r.deploymentObject(app, r.colorObjectMeta(app, color)), reconciler.StateAbsent)
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	return nil, nil
+}
+
+// blueGreenEnabled returns whether the app runs in blue/green mode, which isn't supported in StatefulSet mode
+func blueGreenEnabled(app webappv1.SimpleApp) bool {
+	return app.Spec.BlueGreen != nil && !statefulSet(app)
+}
+
+// activeColor returns the colour that should receive traffic on the app's hostname, before any auto promotion
+func (r *SimpleAppReconciler) activeColor(app webappv1.SimpleApp) webappv1.Color {
+	if app.Spec.BlueGreen.AutoPromote && app.Status.BlueGreen != nil && app.Status.BlueGreen.ActiveColor != "" {
+		return app.Status.BlueGreen.ActiveColor
+	}
+
+	if app.Spec.BlueGreen.ActiveColor == "" {
+		return webappv1.ColorBlue
+	}
+
+	return app.Spec.BlueGreen.ActiveColor
+}
+
+// serviceSelector returns the pod selector for the app's service
+// In blue/green mode, the service selects the active colour once it has taken over from the app's deployment
+// Otherwise it selects the app's web pods by the workload label, so it doesn't select the app's process pods,
+// but keeps its current selector until the workload's pods have the label and are ready, so the service isn't left without endpoints
+func (r *SimpleAppReconciler) serviceSelector(ctx context.Context, app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) (map[string]string, error) {
+	if blueGreenEnabled(app) && app.Status.BlueGreen != nil && app.Status.BlueGreen.ActiveColor != "" {
+		return r.colorObjectMeta(app, app.Status.BlueGreen.ActiveColor).Labels, nil
+	}
+
+	kind := webappv1.WorkloadKindDeployment
+	if statefulSet(app) {
+		kind = webappv1.WorkloadKindStatefulSet
+	}
+	selector := podLabels(objectMeta, kind)
+
+	var current corev1.Service
+	if err := r.Get(ctx, client.ObjectKey{Namespace: objectMeta.Namespace, Name: objectMeta.Name}, &current); err != nil {
+		return selector, client.IgnoreNotFound(err)
+	}
+	if current.Spec.Selector[workloadLabelKey] == string(kind) {
+		return selector, nil
+	}
+
+	ready, err := r.webPodsReady(ctx, app, kind)
+	if err != nil || !ready {
+		return current.Spec.Selector, err
+	}
+
+	return selector, nil
+}
+
+// colorObjectMeta returns the object meta for the app's deployment of the given colour
+func (r *SimpleAppReconciler) colorObjectMeta(app webappv1.SimpleApp, color webappv1.Color) metav1.ObjectMeta {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = fmt.Sprintf("%s-%s", app.Name, color)
+	objectMeta.Labels[colorLabelKey] = string(color)
+
+	return objectMeta
+}
+
+// previewObjectMeta returns the object meta for the app's preview service and ingress, selecting the preview colour
+func (r *SimpleAppReconciler) previewObjectMeta(app webappv1.SimpleApp, preview webappv1.Color) metav1.ObjectMeta {
+	objectMeta := r.colorObjectMeta(app, preview)
+	objectMeta.Name = fmt.Sprintf("%s-preview", app.Name)
+
+	return objectMeta
+}
+
+// previewIngressObject returns the desired ingress for the preview colour, served on the preview hostname
+func (r *SimpleAppReconciler) previewIngressObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *networkingv1.Ingress {
+	previewApp := app.DeepCopy()
+	previewApp.Spec.Hostname = previewHostname(app)
+
+	ingress := r.ingressObject(*previewApp, objectMeta)
+	ingress.Spec.TLS[0].SecretName = fmt.Sprintf("%s-tls", objectMeta.Name)
+
+	return ingress
+}
+
+// previewHostname returns the hostname the app's preview colour is served on
+func previewHostname(app webappv1.SimpleApp) string {
+	if app.Spec.BlueGreen != nil && app.Spec.BlueGreen.PreviewHostname != "" {
+		return app.Spec.BlueGreen.PreviewHostname
+	}
+
+	return fmt.Sprintf("preview-%s", app.Spec.Hostname)
+}
+
+// otherColor returns the opposite colour
+func otherColor(color webappv1.Color) webappv1.Color {
+	if color == webappv1.ColorGreen {
+		return webappv1.ColorBlue
+	}
+
+	return webappv1.ColorGreen
+}
+
+// keepDeploymentTemplate keeps the current pod template of a deployment, along with its template hash
+// Restarts still apply to the kept template, so the deployment's pods are restarted without picking up other changes
+func keepDeploymentTemplate(current, desired runtime.Object) error {
+	currentDeployment, ok := current.(*appsv1.Deployment)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for current deployment", current)
+	}
+	desiredDeployment, ok := desired.(*appsv1.Deployment)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for desired deployment", desired)
+	}
+
+	restarts := desiredDeployment.Spec.Template.Annotations
+	desiredDeployment.Spec.Template = *currentDeployment.Spec.Template.DeepCopy()
+	keepRestartAnnotations(&desiredDeployment.Spec.Template, restarts)
+	if hash, ok := currentDeployment.Annotations[templateHashAnnotationKey]; ok {
+		desiredDeployment.Annotations[templateHashAnnotationKey] = hash
+	} else {
+		delete(desiredDeployment.Annotations, templateHashAnnotationKey)
+	}
+
+	return nil
+}
+
+// keepRestartAnnotations sets the restart annotations of a kept pod template to the desired ones
+func keepRestartAnnotations(template *corev1.PodTemplateSpec, desired map[string]string) {
+	for _, key := range []string{restartedAtAnnotationKey, scheduledRestartAnnotationKey} {
+		value, ok := desired[key]
+		if !ok {
+			delete(template.Annotations, key)
+			continue
+		}
+
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[key] = value
+	}
+}
+
+// templateHash returns a hash of a pod template
+// Restart annotations are left out, so a restart isn't a change to roll out to the other colour or a new rollout
+func templateHash(template corev1.PodTemplateSpec) (string, error) {
+	template = *template.DeepCopy()
+	delete(template.Annotations, restartedAtAnnotationKey)
+	delete(template.Annotations, scheduledRestartAnnotationKey)
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKeepDeploymentTemplateAppliesRestarts(t *testing.T) {
+	current := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{templateHashAnnotationKey: "current"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{scheduledRestartAnnotationKey: "old"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Image: "app:1"}}},
+			},
+		},
+	}
+	desired := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{templateHashAnnotationKey: "desired"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{restartedAtAnnotationKey: "new"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Image: "app:2"}}},
+			},
+		},
+	}
+
+	if err := keepDeploymentTemplate(current, desired); err != nil {
+		t.Fatal(err)
+	}
+
+	template := desired.Spec.Template
+	if template.Spec.Containers[0].Image != "app:1" || desired.Annotations[templateHashAnnotationKey] != "current" {
+		t.Errorf("expected the current template to be kept, got image %s and hash %s", template.Spec.Containers[0].Image, desired.Annotations[templateHashAnnotationKey])
+	}
+	if template.Annotations[restartedAtAnnotationKey] != "new" {
+		t.Errorf("expected the restart to apply to the kept template, got %v", template.Annotations)
+	}
+	if _, ok := template.Annotations[scheduledRestartAnnotationKey]; ok {
+		t.Errorf("expected the removed restart annotation to be removed from the kept template, got %v", template.Annotations)
+	}
+	if current.Spec.Template.Annotations[scheduledRestartAnnotationKey] != "old" {
+		t.Errorf("expected the current deployment to be left unchanged, got %v", current.Spec.Template.Annotations)
+	}
+}
+
+func TestTemplateHashIgnoresRestarts(t *testing.T) {
+	template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "app:1"}}}}
+	restarted := *template.DeepCopy()
+	restarted.Annotations = map[string]string{restartedAtAnnotationKey: "now"}
+
+	hash, err := templateHash(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restartedHash, err := templateHash(restarted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != restartedHash {
+		t.Errorf("expected a restart not to change the template hash")
+	}
+	if restarted.Annotations[restartedAtAnnotationKey] != "now" {
+		t.Errorf("expected the template to be left unchanged")
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	util "github.com/cmmarslender/web-operator/pkg"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Canary ingress annotations, as supported by ingress-nginx
+	canaryAnnotationKey              = "nginx.ingress.kubernetes.io/canary"
+	canaryWeightAnnotationKey        = "nginx.ingress.kubernetes.io/canary-weight"
+	canaryByHeaderAnnotationKey      = "nginx.ingress.kubernetes.io/canary-by-header"
+	canaryByHeaderValueAnnotationKey = "nginx.ingress.kubernetes.io/canary-by-header-value"
+	canaryByCookieAnnotationKey      = "nginx.ingress.kubernetes.io/canary-by-cookie"
+
+	canaryTrack = "canary"
+)
+
+// ReconcileCanary ensures the canary deployment, service and ingress exist while a canary is running,
+// and removes them once the canary is promoted, aborted or removed
+func (r *SimpleAppReconciler) ReconcileCanary(app webappv1.SimpleApp) (*reconcile.Result, error) {
+	objectMeta := r.canaryObjectMeta(app)
+	canaryApp := r.canaryApp(app)
+
+	objects := []client.Object{
+		r.deploymentObject(canaryApp, objectMeta),
+		r.serviceObject(canaryApp, objectMeta),
+		r.canaryIngressObject(canaryApp, objectMeta),
+	}
+
+	active := canaryActive(app)
+	if !active {
+		// Stop routing traffic to the canary before removing the pods
+		for i, j := 0, len(objects)-1; i < j; i, j = i+1, j-1 {
+			objects[i], objects[j] = objects[j], objects[i]
+		}
+	}
+
+	for _, obj := range objects {
+		result, err := r.ReconcileResource(app, obj, util.ReconcilerStateHelper(active))
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	return nil, nil
+}
+
+// canaryStatus returns the observed state of the app's canary, or nil if the app has no canary
+func (r *SimpleAppReconciler) canaryStatus(ctx context.Context, app webappv1.SimpleApp) (*webappv1.CanaryStatus, error) {
+	canary := app.Spec.Canary
+	if canary == nil {
+		return nil, nil
+	}
+
+	status := &webappv1.CanaryStatus{
+		Image:  canary.Image,
+		Weight: canary.Weight,
+	}
+
+	switch {
+	case canary.Action == webappv1.CanaryActionPromote:
+		status.Phase = webappv1.CanaryPhasePromoted
+		status.Message = "The canary image runs in the app's deployment. Update the app's image and remove the canary to finish."
+	case canary.Action == webappv1.CanaryActionAbort:
+		status.Phase = webappv1.CanaryPhaseAborted
+		status.Message = "The canary was removed. Remove the canary from the app to finish."
+	case !app.Spec.IngressEnabled:
+		status.Phase = webappv1.CanaryPhaseInactive
+		status.Message = "The canary requires the ingress to be enabled."
+	case blueGreenEnabled(app):
+		status.Phase = webappv1.CanaryPhaseInactive
+		status.Message = "Canary releases are not supported in blue/green mode."
+	default:
+		deployment, err := r.getDeployment(ctx, app.Namespace, r.canaryObjectMeta(app).Name)
+		if err != nil {
+			return nil, err
+		}
+
+		status.Phase = webappv1.CanaryPhaseProgressing
+		if deployment != nil {
+			status.ReadyReplicas = deployment.Status.ReadyReplicas
+			if deploymentReady(*deployment) {
+				status.Phase = webappv1.CanaryPhaseReady
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// canaryActive returns whether the app's canary should be running
+func canaryActive(app webappv1.SimpleApp) bool {
+	return app.Spec.Canary != nil && app.Spec.Canary.Action == "" && app.Spec.IngressEnabled && !blueGreenEnabled(app)
+}
+
+// primaryApp returns the app as run by its primary deployment, with the image resolved by the image policy
+// and pinned to its digest
+// While a canary is promoted, the primary deployment runs the canary image
+func (r *SimpleAppReconciler) primaryApp(app webappv1.SimpleApp) webappv1.SimpleApp {
+	image := pinnedImage(app, r.unpinnedImage(app))
+	if image == app.Spec.Image {
+		return app
+	}
+
+	primary := app.DeepCopy()
+	primary.Spec.Image = image
+
+	return *primary
+}
+
+// canaryApp returns the app as run by the canary deployment
+func (r *SimpleAppReconciler) canaryApp(app webappv1.SimpleApp) webappv1.SimpleApp {
+	canary := app.DeepCopy()
+	if app.Spec.Canary == nil {
+		return *canary
+	}
+
+	canary.Spec.Image = app.Spec.Canary.Image
+	canary.Spec.ScaleSchedule = nil
+	canary.Spec.Replicas = app.Spec.Canary.Replicas
+	if canary.Spec.Replicas == nil {
+		replicas := int32(1)
+		canary.Spec.Replicas = &replicas
+	}
+
+	return *canary
+}
+
+// canaryObjectMeta returns the object meta for the app's canary resources
+// The canary pods get their own name label, so they aren't selected by the app's service
+func (r *SimpleAppReconciler) canaryObjectMeta(app webappv1.SimpleApp) metav1.ObjectMeta {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = fmt.Sprintf("%s-canary", app.Name)
+	objectMeta.Labels[nameLabelKey] = objectMeta.Name
+	objectMeta.Labels[trackLabelKey] = canaryTrack
+
+	return objectMeta
+}
+
+// canaryIngressObject returns the desired canary ingress for the app, routing to the canary service
+func (r *SimpleAppReconciler) canaryIngressObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *networkingv1.Ingress {
+	ingress := r.ingressObject(app, objectMeta)
+
+	// TLS is configured on the app's ingress, which the canary ingress shares a host with
+	ingress.Spec.TLS = nil
+
+	canary := app.Spec.Canary
+	if canary == nil {
+		return ingress
+	}
+
+	ingress.Annotations[canaryAnnotationKey] = "true"
+	ingress.Annotations[canaryWeightAnnotationKey] = strconv.Itoa(int(canary.Weight))
+	if canary.Header != "" {
+		ingress.Annotations[canaryByHeaderAnnotationKey] = canary.Header
+	}
+	if canary.HeaderValue != "" {
+		ingress.Annotations[canaryByHeaderValueAnnotationKey] = canary.HeaderValue
+	}
+	if canary.Cookie != "" {
+		ingress.Annotations[canaryByCookieAnnotationKey] = canary.Cookie
+	}
+
+	return ingress
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strconv"
+	"strings"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// additionalContainers returns init or sidecar containers for the app
+// Each container shares the app's environment variables and volume mounts
+func (r *SimpleAppReconciler) additionalContainers(app webappv1.SimpleApp, specs []webappv1.ContainerSpec) []corev1.Container {
+	var containers []corev1.Container
+
+	for _, spec := range specs {
+		image := spec.Image
+		if image == "" {
+			image = app.Spec.Image
+		}
+
+		containers = append(containers, corev1.Container{
+			Name:            spec.Name,
+			Image:           r.mirrorImage(image),
+			ImagePullPolicy: app.Spec.ImagePullPolicy,
+			Command:         spec.Command,
+			Args:            spec.Args,
+			Env:             mergeEnv(app.Spec.Env, spec.Env),
+			EnvFrom:         app.Spec.EnvFrom,
+			Ports:           spec.Ports,
+			Resources:       spec.Resources,
+			SecurityContext: r.containerSecurityContext(app),
+			VolumeMounts:    r.volumeMounts(app),
+		})
+	}
+
+	return containers
+}
+
+// lifecycle returns the lifecycle hooks for the app's container
+// An explicit preStop handler takes precedence over the graceful shutdown sleep
+func (r *SimpleAppReconciler) lifecycle(app webappv1.SimpleApp) *corev1.Lifecycle {
+	if app.Spec.PreStop != nil {
+		return &corev1.Lifecycle{PreStop: app.Spec.PreStop}
+	}
+
+	if app.Spec.GracefulShutdown != nil && app.Spec.GracefulShutdown.DelaySeconds > 0 {
+		return &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{
+					Command: []string{"sleep", strconv.FormatInt(app.Spec.GracefulShutdown.DelaySeconds, 10)},
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+// terminationGracePeriodSeconds returns the termination grace period for the app's pods
+// With graceful shutdown, the preStop sleep counts against the grace period, so the default is extended by the delay
+func (r *SimpleAppReconciler) terminationGracePeriodSeconds(app webappv1.SimpleApp) *int64 {
+	if app.Spec.TerminationGracePeriodSeconds != nil {
+		return app.Spec.TerminationGracePeriodSeconds
+	}
+
+	if app.Spec.PreStop == nil && app.Spec.GracefulShutdown != nil && app.Spec.GracefulShutdown.DelaySeconds > 0 {
+		gracePeriod := app.Spec.GracefulShutdown.DelaySeconds + corev1.DefaultTerminationGracePeriodSeconds
+		return &gracePeriod
+	}
+
+	return nil
+}
+
+// mergeEnv returns the base environment variables with the overrides applied
+// Overrides replace base variables with the same name in place, and new variables are appended
+func mergeEnv(base []corev1.EnvVar, overrides []corev1.EnvVar) []corev1.EnvVar {
+	if len(overrides) == 0 {
+		return base
+	}
+
+	env := make([]corev1.EnvVar, 0, len(base)+len(overrides))
+	env = append(env, base...)
+
+	for _, override := range overrides {
+		replaced := false
+		for i := range env {
+			if env[i].Name == override.Name {
+				env[i] = override
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			env = append(env, override)
+		}
+	}
+
+	return env
+}
+
+// expandEnv expands $(VAR_NAME) references in value using the values of the provided environment variables
+// This follows the kubernetes rules for command and args: references to unknown variables are left as is,
+// and $$ escapes a reference, so $$(VAR_NAME) becomes $(VAR_NAME)
+func expandEnv(value string, env []corev1.EnvVar) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+
+	values := map[string]string{}
+	for _, envVar := range env {
+		if envVar.ValueFrom == nil {
+			values[envVar.Name] = envVar.Value
+		}
+	}
+
+	var expanded strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 >= len(value) {
+			expanded.WriteByte(value[i])
+			continue
+		}
+
+		switch value[i+1] {
+		case '$':
+			expanded.WriteByte('$')
+			i++
+		case '(':
+			end := strings.IndexByte(value[i+2:], ')')
+			if end < 0 {
+				expanded.WriteByte(value[i])
+				continue
+			}
+
+			name := value[i+2 : i+2+end]
+			if resolved, ok := values[name]; ok {
+				expanded.WriteString(resolved)
+			} else {
+				expanded.WriteString(value[i : i+3+end])
+			}
+			i += 2 + end
+		default:
+			expanded.WriteByte(value[i])
+		}
+	}
+
+	return expanded.String()
+}
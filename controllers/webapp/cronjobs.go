@@ -0,0 +1,176 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReconcileCronJobs ensures a cron job exists for each of the app's cron jobs, running the app's current image
+// While the pre deploy hook is pending, cron jobs keep running the previous image and new cron jobs aren't created
+// Cron jobs that were removed from the app are deleted
+func (r *SimpleAppReconciler) ReconcileCronJobs(ctx context.Context, app webappv1.SimpleApp) (*reconcile.Result, error) {
+	desired := map[string]bool{}
+
+	for _, spec := range app.Spec.CronJobs {
+		cronJobObject := r.cronJobObject(app, spec)
+		desired[cronJobObject.Name] = true
+
+		state := reconciler.DesiredState(reconciler.StatePresent)
+		if preDeployHookPending(app) {
+			state = preDeployHookState(keepCronJobTemplate)
+		}
+
+		result, err := r.ReconcileResource(app, cronJobObject, state)
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	var cronJobs batchv1.CronJobList
+	if err := r.List(ctx, &cronJobs, client.InNamespace(app.Namespace), client.MatchingLabels{typeLabelKey: app.Kind}, client.HasLabels{cronJobLabelKey}); err != nil {
+		return nil, err
+	}
+
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		if desired[cronJob.Name] || !metav1.IsControlledBy(cronJob, &app) {
+			continue
+		}
+
+		if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// cronJobStatuses returns the observed state of the app's cron jobs, including the result of each cron job's latest run
+func (r *SimpleAppReconciler) cronJobStatuses(ctx context.Context, app webappv1.SimpleApp) ([]webappv1.CronJobStatus, error) {
+	var statuses []webappv1.CronJobStatus
+
+	for _, spec := range app.Spec.CronJobs {
+		objectMeta := r.cronJobObjectMeta(app, spec.Name)
+		status := webappv1.CronJobStatus{Name: spec.Name}
+
+		cronJob := &batchv1.CronJob{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: objectMeta.Namespace, Name: objectMeta.Name}, cronJob)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if err != nil {
+			statuses = append(statuses, status)
+			continue
+		}
+		status.LastScheduleTime = cronJob.Status.LastScheduleTime
+		status.LastSuccessfulTime = cronJob.Status.LastSuccessfulTime
+
+		var jobs batchv1.JobList
+		if err := r.List(ctx, &jobs, client.InNamespace(app.Namespace), client.MatchingLabels(objectMeta.Labels)); err != nil {
+			return nil, err
+		}
+
+		var latest *batchv1.Job
+		for i := range jobs.Items {
+			job := &jobs.Items[i]
+			if !metav1.IsControlledBy(job, cronJob) {
+				continue
+			}
+			if latest == nil || latest.CreationTimestamp.Before(&job.CreationTimestamp) {
+				latest = job
+			}
+		}
+
+		if latest != nil {
+			status.LastJobName = latest.Name
+			status.LastJobPhase, status.Message = jobPhase(*latest)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// cronJobObjectMeta returns the object meta for the app's cron job
+// The cron job's pods get their own name label, so they aren't selected by the app's service
+func (r *SimpleAppReconciler) cronJobObjectMeta(app webappv1.SimpleApp, name string) metav1.ObjectMeta {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = fmt.Sprintf("%s-cron-%s", app.Name, name)
+	objectMeta.Labels[nameLabelKey] = objectMeta.Name
+	objectMeta.Labels[cronJobLabelKey] = name
+
+	return objectMeta
+}
+
+// cronJobObject returns the desired cron job for the app's cron job
+// The cron job is suspended while the app is scaled to zero, so it doesn't start pods for the app either
+func (r *SimpleAppReconciler) cronJobObject(app webappv1.SimpleApp, spec webappv1.CronJobSpec) *batchv1.CronJob {
+	objectMeta := r.cronJobObjectMeta(app, spec.Name)
+	suspend := spec.Suspend || app.Spec.ScaleToZero
+
+	return &batchv1.CronJob{
+		ObjectMeta: objectMeta,
+		Spec: batchv1.CronJobSpec{
+			Schedule:          spec.Schedule,
+			ConcurrencyPolicy: spec.ConcurrencyPolicy,
+			Suspend:           &suspend,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: objectMeta.Labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit:          spec.BackoffLimit,
+					ActiveDeadlineSeconds: spec.ActiveDeadlineSeconds,
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: objectMeta.Labels,
+						},
+						Spec: r.commandPodSpec(r.primaryApp(app), objectMeta, spec.Command, spec.Args),
+					},
+				},
+			},
+		},
+	}
+}
+
+// keepCronJobTemplate keeps the current job template of a cron job, so its runs don't pick up the new image
+func keepCronJobTemplate(current, desired runtime.Object) error {
+	currentCronJob, ok := current.(*batchv1.CronJob)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for current cron job", current)
+	}
+	desiredCronJob, ok := desired.(*batchv1.CronJob)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for desired cron job", desired)
+	}
+
+	desiredCronJob.Spec.JobTemplate = currentCronJob.Spec.JobTemplate
+
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// filesVolumeName is the name of the volume backed by the app's files config map
+	// The name is prefixed so it doesn't collide with the app's own volumes
+	filesVolumeName = "webapp-files"
+)
+
+// invalidFileKeyChars matches characters that aren't allowed in config map keys
+var invalidFileKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// filesConfigMapObject returns the config map holding the app's inline files
+func (r *SimpleAppReconciler) filesConfigMapObject(app webappv1.SimpleApp) *corev1.ConfigMap {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = r.filesConfigMapName(app)
+
+	data := map[string]string{}
+	for path, content := range app.Spec.Files {
+		data[fileKey(path)] = content
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: objectMeta,
+		Data:       data,
+	}
+}
+
+// filesConfigMapName returns the name of the config map holding the app's inline files
+func (r *SimpleAppReconciler) filesConfigMapName(app webappv1.SimpleApp) string {
+	return fmt.Sprintf("%s-files", app.Name)
+}
+
+// filesVolumeMounts returns a volume mount for each of the app's inline files
+func (r *SimpleAppReconciler) filesVolumeMounts(app webappv1.SimpleApp) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+
+	for _, path := range sortedFilePaths(app) {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      filesVolumeName,
+			MountPath: path,
+			SubPath:   fileKey(path),
+			ReadOnly:  true,
+		})
+	}
+
+	return mounts
+}
+
+// filesChecksum returns a checksum of the app's inline files
+// Files mounted with subPath are not updated in running pods, so the checksum is added to the pod template to roll the deployment on changes
+func filesChecksum(app webappv1.SimpleApp) string {
+	hash := sha256.New()
+
+	for _, path := range sortedFilePaths(app) {
+		_, _ = fmt.Fprintf(hash, "%s\x00%s\x00", path, app.Spec.Files[path])
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// sortedFilePaths returns the paths of the app's inline files in a stable order
+func sortedFilePaths(app webappv1.SimpleApp) []string {
+	var paths []string
+
+	for path := range app.Spec.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// fileKey returns the config map key for a file path
+// The key is readable, with a hash of the path so different paths never share a key, such as /etc/a/b.conf and /etc/a_b.conf
+func fileKey(path string) string {
+	key := strings.ReplaceAll(strings.Trim(path, "/"), "/", "_")
+	key = invalidFileKeyChars.ReplaceAllString(key, "-")
+	if len(key) > 200 {
+		key = key[len(key)-200:]
+	}
+
+	hash := sha256.Sum256([]byte(path))
+
+	return fmt.Sprintf("%s-%x", key, hash[:5])
+}
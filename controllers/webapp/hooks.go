@@ -0,0 +1,211 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	preDeployHook = "pre-deploy"
+)
+
+// ReconcilePreDeployHook runs the app's pre deploy hook in a job when the app's image changes,
+// and records the state of the hook for the app's image in the app's status
+// Jobs of earlier images are removed, and a failed job is rerun when it is deleted
+func (r *SimpleAppReconciler) ReconcilePreDeployHook(ctx context.Context, app *webappv1.SimpleApp) (*reconcile.Result, error) {
+	if app.Spec.Hooks == nil || app.Spec.Hooks.PreDeploy == nil {
+		app.Status.PreDeployHook = nil
+		return r.pruneHookJobs(ctx, *app, preDeployHook, "")
+	}
+
+	image := r.primaryApp(*app).Spec.Image
+	jobObject := r.hookJobObject(*app, preDeployHook, *app.Spec.Hooks.PreDeploy, image)
+
+	status := app.Status.PreDeployHook
+	if status == nil || status.Image != image {
+		status = &webappv1.HookStatus{Image: image}
+	}
+	status.JobName = jobObject.Name
+	app.Status.PreDeployHook = status
+
+	// Once the hook succeeded for the image, it doesn't run again, even if its job is removed
+	if status.Phase == webappv1.JobPhaseSucceeded {
+		return r.pruneHookJobs(ctx, *app, preDeployHook, jobObject.Name)
+	}
+
+	current := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: jobObject.Namespace, Name: jobObject.Name}, current)
+	if errors.IsNotFound(err) {
+		status.Phase = webappv1.JobPhaseRunning
+		status.Message = fmt.Sprintf("Running the pre deploy hook for image %s", image)
+		r.Recorder.Eventf(app, corev1.EventTypeNormal, "PreDeployHookStarted", "Started job %s for image %s", jobObject.Name, image)
+
+		result, err := r.ReconcileResource(*app, jobObject, reconciler.StatePresent)
+		if result != nil || err != nil {
+			return result, err
+		}
+
+		return r.pruneHookJobs(ctx, *app, preDeployHook, jobObject.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	phase, message := jobPhase(*current)
+	if phase != status.Phase {
+		switch phase {
+		case webappv1.JobPhaseSucceeded:
+			r.Recorder.Eventf(app, corev1.EventTypeNormal, "PreDeployHookSucceeded", "Job %s for image %s succeeded", current.Name, image)
+		case webappv1.JobPhaseFailed:
+			r.Recorder.Eventf(app, corev1.EventTypeWarning, "PreDeployHookFailed", "Job %s for image %s failed: %s", current.Name, image, message)
+		}
+	}
+	status.Phase = phase
+	status.Message = message
+
+	return r.pruneHookJobs(ctx, *app, preDeployHook, jobObject.Name)
+}
+
+// preDeployHookPending returns whether the app's image is waiting on the pre deploy hook before it may be deployed
+func preDeployHookPending(app webappv1.SimpleApp) bool {
+	if app.Spec.Hooks == nil || app.Spec.Hooks.PreDeploy == nil {
+		return false
+	}
+
+	return app.Status.PreDeployHook == nil || app.Status.PreDeployHook.Phase != webappv1.JobPhaseSucceeded
+}
+
+// preDeployHookState returns the desired state for a workload while the pre deploy hook is pending
+// A workload that doesn't exist yet is not created, and an existing workload is updated with keepTemplate,
+// which keeps its current pod template
+func preDeployHookState(keepTemplate func(current, desired runtime.Object) error) reconciler.DesiredState {
+	return reconciler.DynamicDesiredState{
+		ShouldCreateFunc: func(desired runtime.Object) (bool, error) {
+			return false, nil
+		},
+		BeforeUpdateFunc: keepTemplate,
+	}
+}
+
+// pruneHookJobs removes the app's jobs for the given hook, except for the job to keep
+func (r *SimpleAppReconciler) pruneHookJobs(ctx context.Context, app webappv1.SimpleApp, hook string, keep string) (*reconcile.Result, error) {
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, client.InNamespace(app.Namespace), client.MatchingLabels(r.hookObjectMeta(app, hook).Labels)); err != nil {
+		return nil, err
+	}
+
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Name == keep || !metav1.IsControlledBy(job, &app) {
+			continue
+		}
+
+		// Jobs don't remove their pods by default
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// hookObjectMeta returns the object meta for the app's jobs of the given hook
+// The jobs get their own name label, so their pods aren't selected by the app's service
+func (r *SimpleAppReconciler) hookObjectMeta(app webappv1.SimpleApp, hook string) metav1.ObjectMeta {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = fmt.Sprintf("%s-%s", app.Name, hook)
+	objectMeta.Labels[nameLabelKey] = objectMeta.Name
+	objectMeta.Labels[hookLabelKey] = hook
+
+	return objectMeta
+}
+
+// hookJobObject returns the desired job that runs the hook for the given image
+// The job is named after the image, so a new job runs for each image
+func (r *SimpleAppReconciler) hookJobObject(app webappv1.SimpleApp, hook string, spec webappv1.HookSpec, image string) *batchv1.Job {
+	objectMeta := r.hookObjectMeta(app, hook)
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(image)))
+	objectMeta.Name = fmt.Sprintf("%s-%s", objectMeta.Name, hash[:10])
+
+	app.Spec.Image = image
+
+	return &batchv1.Job{
+		ObjectMeta: objectMeta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          spec.BackoffLimit,
+			ActiveDeadlineSeconds: spec.ActiveDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: objectMeta.Labels,
+				},
+				Spec: r.commandPodSpec(app, objectMeta, spec.Command, spec.Args),
+			},
+		},
+	}
+}
+
+// commandPodSpec returns the pod spec for a job that runs a command in the app's container
+func (r *SimpleAppReconciler) commandPodSpec(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta, command []string, args []string) corev1.PodSpec {
+	podSpec := r.podSpec(app, objectMeta)
+
+	// The app's init containers prepare the web process, such as by running migrations, and would run before every command
+	podSpec.InitContainers = nil
+
+	// Only the app's container runs, since sidecars would keep the job from completing
+	container := podSpec.Containers[0]
+	container.Command = command
+	container.Args = args
+	container.Ports = nil
+	container.Lifecycle = nil
+	podSpec.Containers = []corev1.Container{container}
+	podSpec.RestartPolicy = corev1.RestartPolicyNever
+	podSpec.TopologySpreadConstraints = nil
+
+	return podSpec
+}
+
+// jobPhase returns the phase of the job, along with a message describing it
+func jobPhase(job batchv1.Job) (webappv1.JobPhase, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return webappv1.JobPhaseSucceeded, fmt.Sprintf("Job %s succeeded", job.Name)
+		case batchv1.JobFailed:
+			return webappv1.JobPhaseFailed, fmt.Sprintf("Job %s failed: %s", job.Name, condition.Message)
+		}
+	}
+
+	return webappv1.JobPhaseRunning, fmt.Sprintf("Job %s is running", job.Name)
+}
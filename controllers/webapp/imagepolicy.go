@@ -0,0 +1,363 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	"github.com/cmmarslender/web-operator/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultImagePolicyInterval how often the registry is queried if the policy doesn't set an interval
+	defaultImagePolicyInterval = 5 * time.Minute
+
+	// registryRetryInterval how long until a failed registry query is retried, doubling with each failure in a row
+	registryRetryInterval = 30 * time.Second
+
+	// maxImageDigestRetryInterval the longest wait before retrying to resolve an image's digest
+	maxImageDigestRetryInterval = 5 * time.Minute
+)
+
+// reconcileImagePolicy queries the registry for the newest tag matching the app's image policy when a query is due,
+// records the resolved image and its digest in the app's status, and returns how long until the next query
+// A failed query is reported in the status, and the app keeps the image it resolved before
+// Failed queries are retried with backoff, up to the interval, so an unavailable registry isn't queried on every reconcile
+func (r *SimpleAppReconciler) reconcileImagePolicy(ctx context.Context, app *webappv1.SimpleApp, now time.Time) (time.Duration, error) {
+	policy := app.Spec.ImagePolicy
+	if policy == nil {
+		app.Status.ImagePolicy = nil
+		return 0, nil
+	}
+
+	reference, err := registry.ParseReference(app.Spec.Image)
+	if err != nil {
+		return 0, err
+	}
+
+	interval := time.Duration(policy.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultImagePolicyInterval
+	}
+
+	if app.Status.ImagePolicy == nil {
+		app.Status.ImagePolicy = &webappv1.ImagePolicyStatus{}
+	}
+	status := app.Status.ImagePolicy
+
+	// The resolved image is dropped if the app's image moved to another repository
+	if status.Image != "" {
+		resolved, err := registry.ParseReference(status.Image)
+		if err != nil || !resolved.SameRepository(reference) {
+			status.Image = ""
+			status.Digest = ""
+		}
+	}
+
+	// A change to the app's spec is resolved straight away, otherwise the registry is queried when the interval or the retry is due
+	if status.LastChecked != nil && status.ObservedGeneration == app.Generation {
+		if next := status.LastChecked.Add(registryRetryAfter(status.Failures, interval)); next.After(now) {
+			return next.Sub(now), nil
+		}
+	}
+
+	status.LastChecked = &metav1.Time{Time: now}
+	status.ObservedGeneration = app.Generation
+
+	// Limit the whole query, including pages of tags, so the reconcile isn't held up by a slow registry
+	resolveCtx, cancel := context.WithTimeout(ctx, registry.DefaultTimeout)
+	defer cancel()
+
+	image, digest, err := r.resolveImagePolicy(resolveCtx, *app, reference)
+	if err != nil {
+		status.Failures++
+		if status.Message != err.Error() {
+			r.Recorder.Eventf(app, corev1.EventTypeWarning, "ImagePolicyFailed", "Unable to resolve the image policy: %s", err)
+		}
+		status.Message = err.Error()
+		return registryRetryAfter(status.Failures, interval), nil
+	}
+
+	if status.Image != "" && status.Image != image {
+		r.Recorder.Eventf(app, corev1.EventTypeNormal, "ImageUpdated", "Rolling forward from %s to %s", status.Image, image)
+	}
+	status.Image = image
+	status.Digest = digest
+	status.Failures = 0
+	status.Message = ""
+
+	return interval, nil
+}
+
+// registryRetryAfter returns how long until the registry is queried again, after the given number of failed queries in a row
+// The wait starts at registryRetryInterval and doubles with each failure, up to the interval
+func registryRetryAfter(failures int32, interval time.Duration) time.Duration {
+	if failures <= 0 {
+		return interval
+	}
+
+	retry := registryRetryInterval
+	for i := int32(1); i < failures && retry < interval; i++ {
+		retry *= 2
+	}
+	if retry > interval {
+		return interval
+	}
+
+	return retry
+}
+
+// resolveImagePolicy returns the newest image of the repository that matches the app's image policy, along with its digest
+func (r *SimpleAppReconciler) resolveImagePolicy(ctx context.Context, app webappv1.SimpleApp, reference registry.Reference) (string, string, error) {
+	credentials, err := r.registryCredentials(ctx, app, reference.Registry)
+	if err != nil {
+		return "", "", err
+	}
+
+	tags, err := r.Registry.Tags(ctx, reference, credentials)
+	if err != nil {
+		return "", "", err
+	}
+
+	tag, err := latestTag(tags, *app.Spec.ImagePolicy)
+	if err != nil {
+		return "", "", err
+	}
+	if tag == "" {
+		return "", "", fmt.Errorf("no tags of %s match the image policy", reference.Name())
+	}
+
+	digest, err := r.Registry.Digest(ctx, reference, tag, credentials)
+	if err != nil {
+		return "", "", err
+	}
+
+	return reference.WithTag(tag), digest, nil
+}
+
+// registryCredentials returns the credentials for the registry from the app's image pull secrets,
+// then the config's global image pull secrets, or nil if none of the secrets have credentials for the registry
+func (r *SimpleAppReconciler) registryCredentials(ctx context.Context, app webappv1.SimpleApp, host string) (*registry.Credentials, error) {
+	var secretKeys []client.ObjectKey
+	for _, name := range app.Spec.ImagePullSecrets {
+		secretKeys = append(secretKeys, client.ObjectKey{Namespace: app.Namespace, Name: name})
+	}
+	for _, global := range r.Config.GlobalImagePullSecrets {
+		secretKeys = append(secretKeys, client.ObjectKey{Namespace: global.Namespace, Name: global.Name})
+	}
+
+	for _, secretKey := range secretKeys {
+		var secret corev1.Secret
+		if err := r.Get(ctx, secretKey, &secret); err != nil {
+			return nil, fmt.Errorf("unable to get image pull secret %s: %w", secretKey, err)
+		}
+
+		for _, key := range []string{corev1.DockerConfigJsonKey, corev1.DockerConfigKey} {
+			data, ok := secret.Data[key]
+			if !ok {
+				continue
+			}
+
+			credentials, err := registry.CredentialsFromDockerConfig(data, host)
+			if err != nil {
+				return nil, fmt.Errorf("image pull secret %s: %w", secretKey, err)
+			}
+			if credentials != nil {
+				return credentials, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// policyImage returns the image the app runs: the image resolved by the image policy, or else the app's image
+func policyImage(app webappv1.SimpleApp) string {
+	if app.Spec.ImagePolicy == nil || app.Status.ImagePolicy == nil || app.Status.ImagePolicy.Image == "" {
+		return app.Spec.Image
+	}
+
+	return app.Status.ImagePolicy.Image
+}
+
+// reconcileImageDigest resolves the tag of the image the app runs to a digest, records it in the app's status,
+// and returns how long until a failed attempt is retried
+// The digest is only resolved when the image changes, so other changes to the app don't move it to a tag that was pushed again
+func (r *SimpleAppReconciler) reconcileImageDigest(ctx context.Context, app *webappv1.SimpleApp, now time.Time) (time.Duration, error) {
+	if !app.Spec.PinImageDigest {
+		app.Status.ImageDigest = nil
+		return 0, nil
+	}
+
+	image := r.unpinnedImage(*app)
+	reference, err := registry.ParseReference(image)
+	if err != nil {
+		return 0, err
+	}
+
+	status := app.Status.ImageDigest
+	if status == nil || status.Image != image {
+		status = &webappv1.ImageDigestStatus{Image: image}
+		app.Status.ImageDigest = status
+	}
+	if status.Digest != "" {
+		return 0, nil
+	}
+
+	digest := reference.Digest
+	if policy := app.Status.ImagePolicy; digest == "" && app.Spec.ImagePolicy != nil && policy != nil && policy.Image == image {
+		digest = policy.Digest
+	}
+
+	if digest == "" {
+		if status.LastChecked != nil {
+			if next := status.LastChecked.Add(registryRetryAfter(status.Failures, maxImageDigestRetryInterval)); next.After(now) {
+				return next.Sub(now), nil
+			}
+		}
+		status.LastChecked = &metav1.Time{Time: now}
+
+		tag := reference.Tag
+		if tag == "" {
+			tag = "latest"
+		}
+
+		resolveCtx, cancel := context.WithTimeout(ctx, registry.DefaultTimeout)
+		defer cancel()
+
+		credentials, err := r.registryCredentials(resolveCtx, *app, reference.Registry)
+		if err == nil {
+			digest, err = r.Registry.Digest(resolveCtx, reference, tag, credentials)
+		}
+		if err != nil {
+			status.Failures++
+			if status.Message != err.Error() {
+				r.Recorder.Eventf(app, corev1.EventTypeWarning, "ImageDigestFailed", "Unable to resolve the digest of %s: %s", image, err)
+			}
+			status.Message = err.Error()
+			return registryRetryAfter(status.Failures, maxImageDigestRetryInterval), nil
+		}
+	}
+
+	status.Digest = digest
+	status.Failures = 0
+	status.Message = ""
+
+	return 0, nil
+}
+
+// unpinnedImage returns the image the app's primary deployment runs, before it is pinned to a digest
+// While a canary is promoted, that's the canary image
+func (r *SimpleAppReconciler) unpinnedImage(app webappv1.SimpleApp) string {
+	if app.Spec.Canary != nil && app.Spec.Canary.Action == webappv1.CanaryActionPromote {
+		return app.Spec.Canary.Image
+	}
+
+	return policyImage(app)
+}
+
+// pinnedImage returns the image pinned to the digest resolved for it, or the image as is if it has no resolved digest
+func pinnedImage(app webappv1.SimpleApp, image string) string {
+	status := app.Status.ImageDigest
+	if !app.Spec.PinImageDigest || status == nil || status.Image != image || status.Digest == "" {
+		return image
+	}
+
+	reference, err := registry.ParseReference(image)
+	if err != nil || reference.Digest != "" {
+		return image
+	}
+
+	return fmt.Sprintf("%s@%s", image, status.Digest)
+}
+
+// latestTag returns the newest of the tags that match the policy, or an empty string if none match
+func latestTag(tags []string, policy webappv1.ImagePolicySpec) (string, error) {
+	if policy.Semver == "" && policy.Pattern == "" {
+		return "", fmt.Errorf("the image policy needs a semver range or a pattern")
+	}
+
+	var pattern *regexp.Regexp
+	if policy.Pattern != "" {
+		var err error
+		pattern, err = regexp.Compile(policy.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid image policy pattern %q: %w", policy.Pattern, err)
+		}
+	}
+
+	var constraint *semver.Constraints
+	if policy.Semver != "" {
+		var err error
+		constraint, err = semver.NewConstraint(policy.Semver)
+		if err != nil {
+			return "", fmt.Errorf("invalid image policy semver range %q: %w", policy.Semver, err)
+		}
+	}
+
+	var latest, latestKey string
+	var latestVersion *semver.Version
+	for _, tag := range tags {
+		key := tag
+		if pattern != nil {
+			match := pattern.FindStringSubmatch(tag)
+			if match == nil {
+				continue
+			}
+			if len(match) > 1 {
+				key = match[1]
+			}
+		}
+
+		if constraint != nil {
+			version, err := semver.NewVersion(tag)
+			if err != nil || !constraint.Check(version) {
+				continue
+			}
+			if latestVersion == nil || version.GreaterThan(latestVersion) {
+				latest, latestVersion = tag, version
+			}
+			continue
+		}
+
+		if latest == "" || tagKeyLess(latestKey, key) {
+			latest, latestKey = tag, key
+		}
+	}
+
+	return latest, nil
+}
+
+// tagKeyLess returns whether sort key a comes before b, numerically if both are numbers and alphabetically otherwise
+func tagKeyLess(a string, b string) bool {
+	numberA, errA := strconv.ParseUint(a, 10, 64)
+	numberB, errB := strconv.ParseUint(b, 10, 64)
+	if errA == nil && errB == nil {
+		return numberA < numberB
+	}
+
+	return a < b
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	"github.com/cmmarslender/web-operator/pkg/registry"
+	"k8s.io/client-go/tools/record"
+)
+
+// failingRegistry is a registry that fails every query, counting the queries
+type failingRegistry struct {
+	queries int
+}
+
+func (f *failingRegistry) Tags(ctx context.Context, reference registry.Reference, credentials *registry.Credentials) ([]string, error) {
+	f.queries++
+	return nil, errors.New("registry unavailable")
+}
+
+func (f *failingRegistry) Digest(ctx context.Context, reference registry.Reference, tag string, credentials *registry.Credentials) (string, error) {
+	f.queries++
+	return "", errors.New("registry unavailable")
+}
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"latest", "1.2.0", "1.10.0", "2.0.0", "1.11.0-rc.1", "main-9", "main-10", "main-2", "feature-99"}
+
+	tests := []struct {
+		policy   webappv1.ImagePolicySpec
+		expected string
+	}{
+		{webappv1.ImagePolicySpec{Semver: ">=1.0.0 <2.0.0"}, "1.10.0"},
+		{webappv1.ImagePolicySpec{Semver: "~1.2"}, "1.2.0"},
+		{webappv1.ImagePolicySpec{Semver: ">=3.0.0"}, ""},
+		{webappv1.ImagePolicySpec{Pattern: "^main-([0-9]+)$"}, "main-10"},
+		{webappv1.ImagePolicySpec{Pattern: "^main-"}, "main-9"},
+		{webappv1.ImagePolicySpec{Semver: ">=1.0.0", Pattern: "^1\\."}, "1.10.0"},
+	}
+
+	for _, test := range tests {
+		tag, err := latestTag(tags, test.policy)
+		if err != nil {
+			t.Errorf("%+v: unexpected error %s", test.policy, err)
+			continue
+		}
+
+		if tag != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.policy, test.expected, tag)
+		}
+	}
+
+	for _, policy := range []webappv1.ImagePolicySpec{{}, {Semver: "not a range"}, {Pattern: "("}} {
+		if _, err := latestTag(tags, policy); err == nil {
+			t.Errorf("%+v: expected an error", policy)
+		}
+	}
+}
+
+func TestRegistryRetryAfter(t *testing.T) {
+	interval := 5 * time.Minute
+
+	tests := []struct {
+		failures int32
+		expected time.Duration
+	}{
+		{0, interval},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{5, interval},
+		{100, interval},
+	}
+
+	for _, test := range tests {
+		if retry := registryRetryAfter(test.failures, interval); retry != test.expected {
+			t.Errorf("%d failures: expected %s, got %s", test.failures, test.expected, retry)
+		}
+	}
+}
+
+func TestReconcileImagePolicyBacksOffAfterFailure(t *testing.T) {
+	fake := &failingRegistry{}
+	r := &SimpleAppReconciler{Config: &configv1.Config{}, Recorder: record.NewFakeRecorder(10), Registry: fake}
+
+	app := &webappv1.SimpleApp{}
+	app.Generation = 1
+	app.Spec.Image = "registry.example.com/app:1.0.0"
+	app.Spec.ImagePolicy = &webappv1.ImagePolicySpec{Semver: ">=1.0.0", IntervalSeconds: 300}
+
+	now := time.Now()
+	for _, at := range []time.Duration{0, time.Second, 29 * time.Second} {
+		requeueAfter, err := r.reconcileImagePolicy(context.Background(), app, now.Add(at))
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		if requeueAfter <= 0 {
+			t.Errorf("expected a requeue, got %s", requeueAfter)
+		}
+	}
+	if fake.queries != 1 {
+		t.Errorf("expected 1 query before the retry is due, got %d", fake.queries)
+	}
+
+	if _, err := r.reconcileImagePolicy(context.Background(), app, now.Add(31*time.Second)); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if fake.queries != 2 || app.Status.ImagePolicy.Failures != 2 {
+		t.Errorf("expected a second failed query once the retry is due, got %d queries and %d failures", fake.queries, app.Status.ImagePolicy.Failures)
+	}
+}
+
+// digestRegistry is a registry that resolves every tag to the same digest, counting the queries
+type digestRegistry struct {
+	digest  string
+	queries int
+}
+
+func (d *digestRegistry) Tags(ctx context.Context, reference registry.Reference, credentials *registry.Credentials) ([]string, error) {
+	return nil, nil
+}
+
+func (d *digestRegistry) Digest(ctx context.Context, reference registry.Reference, tag string, credentials *registry.Credentials) (string, error) {
+	d.queries++
+	return d.digest, nil
+}
+
+func TestReconcileImageDigestOnlyResolvesNewImages(t *testing.T) {
+	fake := &digestRegistry{digest: "sha256:1"}
+	r := &SimpleAppReconciler{Config: &configv1.Config{}, Recorder: record.NewFakeRecorder(10), Registry: fake}
+
+	app := &webappv1.SimpleApp{}
+	app.Generation = 1
+	app.Spec.Image = "registry.example.com/app:main"
+	app.Spec.PinImageDigest = true
+
+	now := time.Now()
+	if _, err := r.reconcileImageDigest(context.Background(), app, now); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	// The tag moves, but only an unrelated part of the app changes
+	fake.digest = "sha256:2"
+	app.Generation = 2
+	if _, err := r.reconcileImageDigest(context.Background(), app, now); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if fake.queries != 1 || app.Status.ImageDigest.Digest != "sha256:1" {
+		t.Errorf("expected the digest to stay sha256:1 after 1 query, got %s after %d queries", app.Status.ImageDigest.Digest, fake.queries)
+	}
+
+	app.Spec.Image = "registry.example.com/app:release"
+	if _, err := r.reconcileImageDigest(context.Background(), app, now); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if fake.queries != 2 || app.Status.ImageDigest.Digest != "sha256:2" {
+		t.Errorf("expected the new image to resolve to sha256:2, got %s after %d queries", app.Status.ImageDigest.Digest, fake.queries)
+	}
+}
+
+func TestReconcileImageDigestBacksOffAfterFailure(t *testing.T) {
+	fake := &failingRegistry{}
+	r := &SimpleAppReconciler{Config: &configv1.Config{}, Recorder: record.NewFakeRecorder(10), Registry: fake}
+
+	app := &webappv1.SimpleApp{}
+	app.Spec.Image = "registry.example.com/app:main"
+	app.Spec.PinImageDigest = true
+
+	now := time.Now()
+	for _, at := range []time.Duration{0, time.Second, 29 * time.Second} {
+		if _, err := r.reconcileImageDigest(context.Background(), app, now.Add(at)); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+	}
+	if fake.queries != 1 {
+		t.Errorf("expected 1 query before the retry is due, got %d", fake.queries)
+	}
+}
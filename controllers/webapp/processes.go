@@ -0,0 +1,102 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReconcileProcesses ensures a deployment exists for each of the app's background processes
+// Deployments of processes that were removed from the app, or that have an old name, are deleted
+func (r *SimpleAppReconciler) ReconcileProcesses(ctx context.Context, app webappv1.SimpleApp) (*reconcile.Result, error) {
+	desired := map[string]bool{}
+
+	for name, spec := range app.Spec.Processes {
+		deploymentObject := r.processDeploymentObject(app, name, spec)
+		desired[deploymentObject.Name] = true
+
+		state := reconciler.DesiredState(reconciler.StatePresent)
+		if preDeployHookPending(app) {
+			state = preDeployHookState(keepDeploymentTemplate)
+		}
+
+		result, err := r.ReconcileResource(app, deploymentObject, state)
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	var deployments appsv1.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(app.Namespace), client.MatchingLabels{typeLabelKey: app.Kind}, client.HasLabels{processLabelKey}); err != nil {
+		return nil, err
+	}
+
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if desired[deployment.Name] || !metav1.IsControlledBy(deployment, &app) {
+			continue
+		}
+
+		if err := r.Delete(ctx, deployment); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// processObjectMeta returns the object meta for the deployment of the app's process, named <app>-process-<name>
+// so it can't share a name with the app's canary or colour deployments, which are removed without an ownership check
+// The process pods keep the app's type and name labels, and the process label keeps the process deployments' selectors apart
+// The app's deployment excludes pods with the process label, and the app's service selects its pods by the workload label,
+// which process pods don't get
+func (r *SimpleAppReconciler) processObjectMeta(app webappv1.SimpleApp, name string) metav1.ObjectMeta {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = fmt.Sprintf("%s-process-%s", app.Name, name)
+	objectMeta.Labels[processLabelKey] = name
+
+	return objectMeta
+}
+
+// processDeploymentObject returns the desired deployment for the app's process
+func (r *SimpleAppReconciler) processDeploymentObject(app webappv1.SimpleApp, name string, spec webappv1.ProcessSpec) *appsv1.Deployment {
+	process := r.primaryApp(app)
+	process.Spec.ScaleSchedule = nil
+	process.Spec.Replicas = spec.Replicas
+	if process.Spec.Replicas == nil {
+		replicas := int32(1)
+		process.Spec.Replicas = &replicas
+	}
+
+	deploymentObject := r.deploymentObject(process, r.processObjectMeta(app, name))
+
+	container := &deploymentObject.Spec.Template.Spec.Containers[0]
+	container.Command = spec.Command
+	container.Args = spec.Args
+	container.Resources = spec.Resources
+	container.Ports = nil
+
+	return deploymentObject
+}
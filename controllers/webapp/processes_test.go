@@ -0,0 +1,79 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestProcessPodsKeepAppNameLabel(t *testing.T) {
+	r := &SimpleAppReconciler{}
+	app := webappv1.SimpleApp{
+		TypeMeta:   metav1.TypeMeta{Kind: "SimpleApp"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+	}
+
+	process := podLabels(r.processObjectMeta(app, "worker"), webappv1.WorkloadKindDeployment)
+	if process[nameLabelKey] != "app" || process[processLabelKey] != "worker" {
+		t.Errorf("expected process pods to have the app's name label and the process label, got %v", process)
+	}
+	if _, ok := process[workloadLabelKey]; ok {
+		t.Errorf("expected process pods not to have the workload label, got %v", process)
+	}
+
+	web := podLabels(r.getObjectMeta(app), webappv1.WorkloadKindDeployment)
+	if web[workloadLabelKey] != string(webappv1.WorkloadKindDeployment) {
+		t.Errorf("expected web pods to have the workload label, got %v", web)
+	}
+}
+
+func TestKeepDeploymentSelector(t *testing.T) {
+	current := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{nameLabelKey: "app"}}},
+	}
+	desired := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{nameLabelKey: "app"}}},
+	}
+	excludeProcesses(desired.Spec.Selector)
+
+	called := false
+	state := keepDeploymentSelector(reconciler.DynamicDesiredState{
+		BeforeUpdateFunc: func(current, desired runtime.Object) error {
+			called = true
+			return nil
+		},
+	})
+	if err := state.BeforeUpdate(current, desired); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(desired.Spec.Selector.MatchExpressions) > 0 {
+		t.Errorf("expected the current selector to be kept, got %v", desired.Spec.Selector)
+	}
+	if !called {
+		t.Error("expected the wrapped state's BeforeUpdateFunc to be called")
+	}
+	if keepDeploymentSelector(reconciler.StateAbsent) != reconciler.StateAbsent {
+		t.Error("expected an absent state to be left alone")
+	}
+}
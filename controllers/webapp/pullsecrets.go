@@ -0,0 +1,222 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ReconcileGlobalImagePullSecrets copies the config's global image pull secrets into the app's namespace,
+// and deletes copies of secrets that were removed from the config
+// The copies are shared by all apps in the namespace, so they aren't owned by the app
+// Secrets in the namespace that weren't copied by the operator are left alone
+func (r *SimpleAppReconciler) ReconcileGlobalImagePullSecrets(ctx context.Context, app webappv1.SimpleApp) (*reconcile.Result, error) {
+	// Copies are pruned first, so a secret that now comes from another namespace can be copied again
+	var copies corev1.SecretList
+	if err := r.List(ctx, &copies, client.InNamespace(app.Namespace), client.HasLabels{globalImagePullSecretLabelKey}); err != nil {
+		return nil, err
+	}
+
+	for i := range copies.Items {
+		secret := &copies.Items[i]
+		if r.globalImagePullSecret(secret.Labels[globalImagePullSecretLabelKey], secret.Name) {
+			continue
+		}
+
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	for _, global := range r.Config.GlobalImagePullSecrets {
+		if global.Namespace == app.Namespace {
+			continue
+		}
+
+		var source corev1.Secret
+		err := r.Get(ctx, client.ObjectKey{Namespace: global.Namespace, Name: global.Name}, &source)
+		if errors.IsNotFound(err) {
+			r.Recorder.Eventf(&app, corev1.EventTypeWarning, "GlobalImagePullSecretMissing", "Global image pull secret %s/%s doesn't exist", global.Namespace, global.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := r.copyGlobalImagePullSecret(ctx, app, source); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// copyGlobalImagePullSecret creates or updates the copy of the global image pull secret in the app's namespace
+// The copy is written without the last-applied annotation, which would hold a second copy of the secret's data
+func (r *SimpleAppReconciler) copyGlobalImagePullSecret(ctx context.Context, app webappv1.SimpleApp, source corev1.Secret) error {
+	var current corev1.Secret
+	err := r.Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: source.Name}, &current)
+	if errors.IsNotFound(err) {
+		return r.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: app.Namespace,
+				Name:      source.Name,
+				Labels:    map[string]string{globalImagePullSecretLabelKey: source.Namespace},
+			},
+			Type: source.Type,
+			Data: source.Data,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if current.Labels[globalImagePullSecretLabelKey] != source.Namespace {
+		r.Recorder.Eventf(&app, corev1.EventTypeWarning, "GlobalImagePullSecretConflict", "Secret %s already exists and wasn't copied from %s", source.Name, source.Namespace)
+		return nil
+	}
+
+	// The type of a secret can't be changed, so the copy is replaced
+	if current.Type != source.Type {
+		if err := r.Delete(ctx, &current); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		return r.copyGlobalImagePullSecret(ctx, app, source)
+	}
+
+	_, annotated := current.Annotations[lastAppliedAnnotationKey]
+	if equality.Semantic.DeepEqual(current.Data, source.Data) && !annotated {
+		return nil
+	}
+
+	// Copies written before didn't skip the annotation, so it's removed
+	delete(current.Annotations, lastAppliedAnnotationKey)
+	current.Data = source.Data
+
+	return r.Update(ctx, &current)
+}
+
+// globalImagePullSecret returns whether the secret is one of the config's global image pull secrets
+func (r *SimpleAppReconciler) globalImagePullSecret(namespace string, name string) bool {
+	for _, global := range r.Config.GlobalImagePullSecrets {
+		if global.Namespace == namespace && global.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appsForSecret returns a request for each app a change to the secret affects:
+// every app for a global image pull secret, and the apps in the namespace of a copy of one
+func (r *SimpleAppReconciler) appsForSecret(obj client.Object) []reconcile.Request {
+	var opts []client.ListOption
+	switch {
+	case r.withConfig().globalImagePullSecret(obj.GetNamespace(), obj.GetName()):
+	case obj.GetLabels()[globalImagePullSecretLabelKey] != "":
+		opts = append(opts, client.InNamespace(obj.GetNamespace()))
+	default:
+		return nil
+	}
+
+	var apps webappv1.SimpleAppList
+	if err := r.List(context.Background(), &apps, opts...); err != nil {
+		r.Log.Error(err, "unable to list apps", "secret", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, app := range apps.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+		})
+	}
+
+	return requests
+}
+
+// secretSources returns a source for the copies of the global image pull secrets, and one for each global image pull secret
+// Each source has its own cache limited to the secrets it's for, so the operator doesn't cache every secret in the cluster
+// Global image pull secrets added to the config after the operator started aren't watched until it restarts,
+// their changes are copied the next time the apps are reconciled
+func (r *SimpleAppReconciler) secretSources(mgr ctrl.Manager) ([]source.Source, error) {
+	copied, err := labels.NewRequirement(globalImagePullSecretLabelKey, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []cache.Options{{
+		SelectorsByObject: cache.SelectorsByObject{&corev1.Secret{}: {Label: labels.NewSelector().Add(*copied)}},
+	}}
+	for _, global := range r.Config.GlobalImagePullSecrets {
+		options = append(options, cache.Options{
+			Namespace:         global.Namespace,
+			SelectorsByObject: cache.SelectorsByObject{&corev1.Secret{}: {Field: fields.OneTermEqualSelector("metadata.name", global.Name)}},
+		})
+	}
+
+	var sources []source.Source
+	for _, opts := range options {
+		opts.Scheme = mgr.GetScheme()
+		opts.Mapper = mgr.GetRESTMapper()
+
+		secretCache, err := cache.New(mgr.GetConfig(), opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := mgr.Add(secretCache); err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, source.NewKindWithCache(&corev1.Secret{}, secretCache))
+	}
+
+	return sources, nil
+}
+
+// imagePullSecrets returns the image pull secrets for the app's pods: the app's own, then the config's global ones
+func (r *SimpleAppReconciler) imagePullSecrets(app webappv1.SimpleApp) []corev1.LocalObjectReference {
+	names := append([]string{}, app.Spec.ImagePullSecrets...)
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	for _, global := range r.Config.GlobalImagePullSecrets {
+		if !seen[global.Name] {
+			seen[global.Name] = true
+			names = append(names, global.Name)
+		}
+	}
+
+	return r.namesToLocalObjectRefs(names)
+}
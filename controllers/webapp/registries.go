@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	"github.com/cmmarslender/web-operator/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileAllowedRegistries flags the app with the UnapprovedRegistry condition if any of its images are from registries
+// the config doesn't allow, and returns whether the app is rejected because the config enforces the allowed registries
+func (r *SimpleAppReconciler) reconcileAllowedRegistries(app *webappv1.SimpleApp) (bool, error) {
+	unapproved, err := r.unapprovedImages(*app)
+	if err != nil {
+		return false, err
+	}
+
+	if len(unapproved) == 0 {
+		meta.RemoveStatusCondition(&app.Status.Conditions, unapprovedRegistryConditionType)
+		return false, nil
+	}
+
+	reason := "Flagged"
+	message := fmt.Sprintf("Images from registries that aren't allowed: %s", strings.Join(unapproved, ", "))
+	if r.Config.EnforceAllowedRegistries {
+		reason = "Rejected"
+		message = fmt.Sprintf("%s. The app's resources are not updated", message)
+	}
+
+	condition := meta.FindStatusCondition(app.Status.Conditions, unapprovedRegistryConditionType)
+	if condition == nil || condition.Message != message {
+		r.Recorder.Event(app, corev1.EventTypeWarning, "UnapprovedRegistry", message)
+	}
+
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:               unapprovedRegistryConditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: app.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+
+	return r.Config.EnforceAllowedRegistries, nil
+}
+
+// unapprovedImages returns the app's images that are from registries the config doesn't allow
+func (r *SimpleAppReconciler) unapprovedImages(app webappv1.SimpleApp) ([]string, error) {
+	if len(r.Config.AllowedRegistries) == 0 {
+		return nil, nil
+	}
+
+	images := []string{app.Spec.Image}
+	if app.Spec.Canary != nil {
+		images = append(images, app.Spec.Canary.Image)
+	}
+	for _, container := range append(app.Spec.InitContainers, app.Spec.Sidecars...) {
+		if container.Image != "" {
+			images = append(images, container.Image)
+		}
+	}
+
+	var unapproved []string
+	for _, image := range images {
+		reference, err := registry.ParseReference(image)
+		if err != nil {
+			return nil, err
+		}
+
+		if !allowedRegistry(reference, r.Config.AllowedRegistries) {
+			unapproved = append(unapproved, image)
+		}
+	}
+
+	return unapproved, nil
+}
+
+// allowedRegistry returns whether the image is in one of the allowed registries
+func allowedRegistry(reference registry.Reference, allowed []string) bool {
+	for _, registry := range allowed {
+		if reference.InRegistry(registry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mirrorImage returns the image rewritten by the first registry mirror that matches it, or the image as is
+func (r *SimpleAppReconciler) mirrorImage(image string) string {
+	reference, err := registry.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	for _, mirror := range r.Config.RegistryMirrors {
+		if mirrored, ok := reference.Mirror(mirror.Registry, mirror.Mirror); ok {
+			return mirrored
+		}
+	}
+
+	return image
+}
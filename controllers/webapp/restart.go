@@ -0,0 +1,75 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileRestartSchedule records restarts from the app's restart schedule in its status,
+// and returns how long until the next scheduled restart
+// An invalid schedule is reported with the InvalidRestartSchedule condition, and no restarts are scheduled
+func (r *SimpleAppReconciler) reconcileRestartSchedule(app *webappv1.SimpleApp, now time.Time) time.Duration {
+	// The last scheduled restart is kept, so removing the schedule doesn't restart the app again
+	if app.Spec.RestartSchedule == "" {
+		app.Status.NextScheduledRestart = nil
+		meta.RemoveStatusCondition(&app.Status.Conditions, invalidRestartScheduleConditionType)
+		return 0
+	}
+
+	schedule, err := cron.ParseStandard(app.Spec.RestartSchedule)
+	if err != nil {
+		message := fmt.Sprintf("Invalid restart schedule %q: %s", app.Spec.RestartSchedule, err)
+		condition := meta.FindStatusCondition(app.Status.Conditions, invalidRestartScheduleConditionType)
+		if condition == nil || condition.Message != message {
+			r.Recorder.Event(app, corev1.EventTypeWarning, "InvalidRestartSchedule", message)
+		}
+
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               invalidRestartScheduleConditionType,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: app.Generation,
+			Reason:             "InvalidSchedule",
+			Message:            message,
+		})
+		app.Status.NextScheduledRestart = nil
+		return 0
+	}
+	meta.RemoveStatusCondition(&app.Status.Conditions, invalidRestartScheduleConditionType)
+
+	upcoming := schedule.Next(now)
+	next := app.Status.NextScheduledRestart
+
+	switch {
+	case next == nil || next.Time.After(upcoming):
+		// The schedule is new or changed, so the app isn't restarted until the schedule next fires
+		next = &metav1.Time{Time: upcoming}
+	case !now.Before(next.Time):
+		app.Status.LastScheduledRestart = next
+		next = &metav1.Time{Time: upcoming}
+	}
+	app.Status.NextScheduledRestart = next
+
+	return next.Sub(now)
+}
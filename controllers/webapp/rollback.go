@@ -0,0 +1,169 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// revisionAnnotationKey is set on deployments and replica sets by the deployment controller
+	revisionAnnotationKey = "deployment.kubernetes.io/revision"
+)
+
+// ReconcileRollout tracks rollouts of the app's deployment, and returns the desired state to reconcile the deployment with
+// When a rollout fails, the app is marked degraded and, with AutoRollback, the deployment is reverted to the last known good revision
+// While the app is suspended, rollouts are only tracked and failed rollouts aren't reverted
+func (r *SimpleAppReconciler) ReconcileRollout(ctx context.Context, app *webappv1.SimpleApp, deploymentObject *appsv1.Deployment) (reconciler.DesiredState, error) {
+	desiredHash, err := templateHash(deploymentObject.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	deploymentObject.Annotations = map[string]string{templateHashAnnotationKey: desiredHash}
+
+	current, err := r.getDeployment(ctx, app.Namespace, app.Name)
+	if err != nil || current == nil {
+		return reconciler.StatePresent, err
+	}
+
+	if app.Status.Rollout == nil {
+		app.Status.Rollout = &webappv1.RolloutStatus{}
+	}
+	rollout := app.Status.Rollout
+	currentHash := current.Annotations[templateHashAnnotationKey]
+
+	// The app changed since the failed rollout, so it's rolled out again
+	if rollout.FailedTemplateHash != "" && rollout.FailedTemplateHash != desiredHash {
+		rollout.FailedTemplateHash = ""
+		rollout.FailedImage = ""
+		rollout.RolledBack = false
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               degradedConditionType,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: app.Generation,
+			Reason:             "RolloutStarted",
+			Message:            "A new rollout started after a failed rollout",
+		})
+	}
+
+	failed, failedMessage := rolloutFailed(*current)
+
+	switch {
+	case rollout.FailedTemplateHash == "" && currentHash == desiredHash && failed:
+		rollout.FailedTemplateHash = desiredHash
+		rollout.FailedImage = deploymentImage(*current)
+
+		message := fmt.Sprintf("Rollout of image %s failed: %s", rollout.FailedImage, failedMessage)
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               degradedConditionType,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: app.Generation,
+			Reason:             "RolloutFailed",
+			Message:            message,
+		})
+		r.Recorder.Event(app, corev1.EventTypeWarning, "RolloutFailed", message)
+
+		if !app.Spec.AutoRollback || rollout.LastKnownGoodRevision == "" || suspended(*app) {
+			return reconciler.StatePresent, nil
+		}
+
+		template, err := r.revisionTemplate(ctx, *current, rollout.LastKnownGoodRevision)
+		if err != nil {
+			return nil, err
+		}
+		if template == nil {
+			r.Recorder.Eventf(app, corev1.EventTypeWarning, "RollbackFailed", "Revision %s to roll back to was not found", rollout.LastKnownGoodRevision)
+			return reconciler.StatePresent, nil
+		}
+
+		// Revisions from before the pods got the workload label would drop out of the app's service
+		template.Labels = deploymentObject.Spec.Template.Labels
+		deploymentObject.Spec.Template = *template
+		rollout.RolledBack = true
+		r.Recorder.Eventf(app, corev1.EventTypeNormal, "RolledBack", "Rolled back to revision %s with image %s", rollout.LastKnownGoodRevision, rollout.LastKnownGoodImage)
+	case rollout.FailedTemplateHash != "" && rollout.RolledBack:
+		// Stay on the reverted revision until the app changes
+		return reconciler.DynamicDesiredState{BeforeUpdateFunc: keepDeploymentTemplate}, nil
+	case rollout.FailedTemplateHash == "" && currentHash == desiredHash && deploymentReady(*current):
+		rollout.LastKnownGoodRevision = current.Annotations[revisionAnnotationKey]
+		rollout.LastKnownGoodImage = deploymentImage(*current)
+		meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+			Type:               degradedConditionType,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: app.Generation,
+			Reason:             "RolloutComplete",
+			Message:            fmt.Sprintf("Image %s rolled out successfully", rollout.LastKnownGoodImage),
+		})
+	}
+
+	return reconciler.StatePresent, nil
+}
+
+// revisionTemplate returns the pod template of the given revision of the deployment, or nil if the revision no longer exists
+func (r *SimpleAppReconciler) revisionTemplate(ctx context.Context, deployment appsv1.Deployment, revision string) (*corev1.PodTemplateSpec, error) {
+	var replicaSets appsv1.ReplicaSetList
+	if err := r.List(ctx, &replicaSets, client.InNamespace(deployment.Namespace), client.MatchingLabels(deployment.Spec.Selector.MatchLabels)); err != nil {
+		return nil, err
+	}
+
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(replicaSet, &deployment) || replicaSet.Annotations[revisionAnnotationKey] != revision {
+			continue
+		}
+
+		template := replicaSet.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+		return template, nil
+	}
+
+	return nil, nil
+}
+
+// rolloutFailed returns whether the deployment's latest rollout exceeded its progress deadline, along with the reason given
+func rolloutFailed(deployment appsv1.Deployment) (bool, string) {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false, ""
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			return true, condition.Message
+		}
+	}
+
+	return false, ""
+}
+
+// deploymentImage returns the image of the deployment's first container
+func deploymentImage(deployment appsv1.Deployment) string {
+	if len(deployment.Spec.Template.Spec.Containers) == 0 {
+		return ""
+	}
+
+	return deployment.Spec.Template.Spec.Containers[0].Image
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	util "github.com/cmmarslender/web-operator/pkg"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileScaleSchedule records the active scale window in the app's status,
+// and returns how long until the next window starts or ends
+// Windows with invalid schedules, and windows with the name of an earlier window, are skipped,
+// and reported with the InvalidScaleSchedule condition
+func (r *SimpleAppReconciler) reconcileScaleSchedule(app *webappv1.SimpleApp, now time.Time) time.Duration {
+	app.Status.ActiveScaleWindow = ""
+
+	var requeueAfter time.Duration
+	var invalid []string
+	names := map[string]bool{}
+	for _, window := range app.Spec.ScaleSchedule {
+		if names[window.Name] {
+			invalid = append(invalid, fmt.Sprintf("duplicate scale window name %s", window.Name))
+			continue
+		}
+		names[window.Name] = true
+
+		start, err := cron.ParseStandard(window.Start)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("invalid start schedule %q for scale window %s: %s", window.Start, window.Name, err))
+			continue
+		}
+
+		end, err := cron.ParseStandard(window.End)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("invalid end schedule %q for scale window %s: %s", window.End, window.Name, err))
+			continue
+		}
+
+		// The window is active if it ends before it next starts
+		nextStart := start.Next(now)
+		nextEnd := end.Next(now)
+		if nextEnd.Before(nextStart) && app.Status.ActiveScaleWindow == "" {
+			app.Status.ActiveScaleWindow = window.Name
+		}
+
+		boundary := nextStart
+		if nextEnd.Before(nextStart) {
+			boundary = nextEnd
+		}
+		requeueAfter = util.RequeueAfterHelper(requeueAfter, boundary.Sub(now))
+	}
+
+	if len(invalid) == 0 {
+		meta.RemoveStatusCondition(&app.Status.Conditions, invalidScaleScheduleConditionType)
+		return requeueAfter
+	}
+
+	message := fmt.Sprintf("Skipping invalid scale windows: %s", strings.Join(invalid, "; "))
+	condition := meta.FindStatusCondition(app.Status.Conditions, invalidScaleScheduleConditionType)
+	if condition == nil || condition.Message != message {
+		r.Recorder.Event(app, corev1.EventTypeWarning, "InvalidScaleSchedule", message)
+	}
+
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:               invalidScaleScheduleConditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: app.Generation,
+		Reason:             "InvalidSchedule",
+		Message:            message,
+	})
+
+	return requeueAfter
+}
+
+// activeScaleWindow returns the app's active scale window, or nil if no window is active
+func activeScaleWindow(app webappv1.SimpleApp) *webappv1.ScaleWindow {
+	if app.Status.ActiveScaleWindow == "" {
+		return nil
+	}
+
+	for i := range app.Spec.ScaleSchedule {
+		if app.Spec.ScaleSchedule[i].Name == app.Status.ActiveScaleWindow {
+			return &app.Spec.ScaleSchedule[i]
+		}
+	}
+
+	return nil
+}
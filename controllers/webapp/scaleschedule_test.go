@@ -0,0 +1,64 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReconcileScaleScheduleSkipsDuplicateNames(t *testing.T) {
+	r := &SimpleAppReconciler{Config: &configv1.Config{}, Recorder: record.NewFakeRecorder(10)}
+
+	app := &webappv1.SimpleApp{}
+	app.Spec.ScaleSchedule = []webappv1.ScaleWindow{
+		{Name: "busy", Start: "0 0 1 1 *", End: "0 0 2 1 *", Replicas: 2},
+		{Name: "busy", Start: "0 0 * * *", End: "59 23 * * *", Replicas: 5},
+	}
+
+	r.reconcileScaleSchedule(app, time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	if app.Status.ActiveScaleWindow != "" {
+		t.Errorf("expected the duplicate window to be skipped, got active window %s", app.Status.ActiveScaleWindow)
+	}
+	if !meta.IsStatusConditionTrue(app.Status.Conditions, invalidScaleScheduleConditionType) {
+		t.Errorf("expected the %s condition, got %v", invalidScaleScheduleConditionType, app.Status.Conditions)
+	}
+}
+
+func TestTopologySpreadConstraintsUseScaleWindowReplicas(t *testing.T) {
+	r := &SimpleAppReconciler{Config: &configv1.Config{TopologySpread: configv1.TopologySpreadConfig{Enabled: true}}}
+
+	replicas := int32(1)
+	app := webappv1.SimpleApp{}
+	app.Spec.Replicas = &replicas
+	app.Spec.ScaleSchedule = []webappv1.ScaleWindow{{Name: "busy", Replicas: 3}}
+
+	if constraints := r.topologySpreadConstraints(app, r.getObjectMeta(app)); len(constraints) > 0 {
+		t.Errorf("expected no spread outside the window, got %v", constraints)
+	}
+
+	app.Status.ActiveScaleWindow = "busy"
+	if constraints := r.topologySpreadConstraints(app, r.getObjectMeta(app)); len(constraints) == 0 {
+		t.Error("expected the window's replicas to be spread")
+	}
+}
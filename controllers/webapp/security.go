@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+
+	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// tmpVolumeName is the name of the emptyDir mounted at /tmp when the root filesystem is read-only
+	// The name is prefixed so it doesn't collide with the app's own volumes
+	tmpVolumeName = "webapp-tmp"
+	tmpMountPath  = "/tmp"
+)
+
+// securityBaseline returns the global security baseline that applies to the app
+func (r *SimpleAppReconciler) securityBaseline(app webappv1.SimpleApp) configv1.SecurityBaselineConfig {
+	if app.Spec.DisableSecurityBaseline {
+		return configv1.SecurityBaselineConfig{}
+	}
+
+	return r.Config.SecurityBaseline
+}
+
+// podSecurityContext returns the app's pod security context with the security baseline applied
+func (r *SimpleAppReconciler) podSecurityContext(app webappv1.SimpleApp) *corev1.PodSecurityContext {
+	baseline := r.securityBaseline(app)
+
+	securityContext := app.Spec.PodSecurityContext.DeepCopy()
+	if securityContext == nil {
+		if !baseline.RunAsNonRoot && !baseline.SeccompRuntimeDefault {
+			return nil
+		}
+		securityContext = &corev1.PodSecurityContext{}
+	}
+
+	if baseline.RunAsNonRoot && securityContext.RunAsNonRoot == nil {
+		runAsNonRoot := true
+		securityContext.RunAsNonRoot = &runAsNonRoot
+	}
+
+	if baseline.SeccompRuntimeDefault && securityContext.SeccompProfile == nil {
+		securityContext.SeccompProfile = &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		}
+	}
+
+	return securityContext
+}
+
+// containerSecurityContext returns the app container's security context with the security baseline applied
+func (r *SimpleAppReconciler) containerSecurityContext(app webappv1.SimpleApp) *corev1.SecurityContext {
+	baseline := r.securityBaseline(app)
+
+	securityContext := app.Spec.SecurityContext.DeepCopy()
+	if securityContext == nil {
+		if !baseline.ReadOnlyRootFilesystem && !baseline.DropAllCapabilities {
+			return nil
+		}
+		securityContext = &corev1.SecurityContext{}
+	}
+
+	if baseline.ReadOnlyRootFilesystem && securityContext.ReadOnlyRootFilesystem == nil {
+		readOnlyRootFilesystem := true
+		securityContext.ReadOnlyRootFilesystem = &readOnlyRootFilesystem
+	}
+
+	if baseline.DropAllCapabilities && securityContext.Capabilities == nil {
+		securityContext.Capabilities = &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		}
+	}
+
+	return securityContext
+}
+
+// readOnlyRootFilesystem returns whether the app container ends up with a read-only root filesystem
+func (r *SimpleAppReconciler) readOnlyRootFilesystem(app webappv1.SimpleApp) bool {
+	securityContext := r.containerSecurityContext(app)
+
+	return securityContext != nil && securityContext.ReadOnlyRootFilesystem != nil && *securityContext.ReadOnlyRootFilesystem
+}
+
+// tmpVolumeNeeded returns whether the app container gets an emptyDir at /tmp
+// It's left out when the root filesystem is writable, or when one of the app's volumes or files is already mounted at /tmp
+func (r *SimpleAppReconciler) tmpVolumeNeeded(app webappv1.SimpleApp) bool {
+	if !r.readOnlyRootFilesystem(app) {
+		return false
+	}
+
+	for _, volume := range app.Spec.Volumes {
+		if path.Clean(volume.MountPath) == tmpMountPath {
+			return false
+		}
+	}
+
+	for filePath := range app.Spec.Files {
+		if path.Clean(filePath) == tmpMountPath {
+			return false
+		}
+	}
+
+	return true
+}
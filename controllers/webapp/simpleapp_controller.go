@@ -19,44 +19,83 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/banzaicloud/k8s-objectmatcher/patch"
 	"github.com/banzaicloud/operator-tools/pkg/reconciler"
 	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
 	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
 	util "github.com/cmmarslender/web-operator/pkg"
+	"github.com/cmmarslender/web-operator/pkg/configfile"
+	"github.com/cmmarslender/web-operator/pkg/registry"
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
 	// Annotations
-	lastAppliedAnnotationKey = "webapp.k8s.cmm.io/last-applied"
+	lastAppliedAnnotationKey      = "webapp.k8s.cmm.io/last-applied"
+	filesChecksumAnnotationKey    = "webapp.k8s.cmm.io/files-checksum"
+	templateHashAnnotationKey     = "webapp.k8s.cmm.io/template-hash"
+	pausedAnnotationKey           = "webapp.k8s.cmm.io/paused"
+	restartedAtAnnotationKey      = "webapp.k8s.cmm.io/restarted-at"
+	scheduledRestartAnnotationKey = "webapp.k8s.cmm.io/scheduled-restart-at"
 
 	// Labels
-	typeLabelKey = "webapp.k8s.cmm.io/type" // SimpleApp, etc
-	nameLabelKey = "webapp.k8s.cmm.io/name"
+	typeLabelKey    = "webapp.k8s.cmm.io/type" // SimpleApp, etc
+	nameLabelKey    = "webapp.k8s.cmm.io/name"
+	volumeLabelKey  = "webapp.k8s.cmm.io/volume"
+	trackLabelKey   = "webapp.k8s.cmm.io/track"   // canary, etc
+	colorLabelKey   = "webapp.k8s.cmm.io/color"   // blue, green
+	hookLabelKey    = "webapp.k8s.cmm.io/hook"    // pre-deploy, etc
+	processLabelKey = "webapp.k8s.cmm.io/process" // worker, etc
+	cronJobLabelKey = "webapp.k8s.cmm.io/cron-job"
+
+	globalImagePullSecretLabelKey = "webapp.k8s.cmm.io/global-image-pull-secret" // source namespace
+	workloadLabelKey              = "webapp.k8s.cmm.io/workload"                 // Deployment, StatefulSet
+
+	// Conditions
+	degradedConditionType  = "Degraded"
+	suspendedConditionType = "Suspended"
+
+	unapprovedRegistryConditionType     = "UnapprovedRegistry"
+	invalidScaleScheduleConditionType   = "InvalidScaleSchedule"
+	invalidRestartScheduleConditionType = "InvalidRestartSchedule"
 )
 
 // SimpleAppReconciler reconciles a SimpleApp object
 type SimpleAppReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Config *configv1.Config
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Config   *configv1.Config
+	Recorder record.EventRecorder
+	Registry registry.Client
+
+	// ConfigWatcher reloads the config from its file. If set, each reconcile uses the config current when it starts
+	ConfigWatcher *configfile.Watcher
 }
 
 //+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleapps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleapps/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleapps/finalizers,verbs=update
+//+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleappclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleappdefaults,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,49 +106,299 @@ type SimpleAppReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
-func (r *SimpleAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *SimpleAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
 	r.Log.Info(fmt.Sprintf("SimpleApp name is %s", req.NamespacedName))
+	r = r.withConfig()
 
 	var app webappv1.SimpleApp
 	if err := r.Get(ctx, req.NamespacedName, &app); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// Only the status is written back, so the class's and the namespace defaults' fields aren't persisted in the app's spec
+	if err := r.applyClass(ctx, &app); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.applyDefaults(ctx, &app); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// @TODO move these to a desired state generator
-	// Deployment
 	objectMeta := r.getObjectMeta(app)
-	deploymentObject := &appsv1.Deployment{
+	originalStatus := app.Status.DeepCopy()
+
+	// The status is written on every return, so what was recorded before an error, such as a rollback, isn't lost
+	defer func() {
+		if statusErr := r.updateStatus(ctx, &app, originalStatus); statusErr != nil && err == nil {
+			err = statusErr
+		}
+	}()
+
+	// While suspended, only the status is reported
+	if suspended(app) {
+		return r.reconcileSuspendedStatus(ctx, &app)
+	}
+	meta.RemoveStatusCondition(&app.Status.Conditions, suspendedConditionType)
+
+	// Apps with images from registries that aren't allowed are only flagged, unless the config enforces the allowed registries
+	rejected, err := r.reconcileAllowedRegistries(&app)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if rejected {
+		return reconcile.Result{}, nil
+	}
+
+	now := time.Now()
+	requeueAfter := r.reconcileRestartSchedule(&app, now)
+
+	scaleRequeueAfter := r.reconcileScaleSchedule(&app, now)
+	requeueAfter = util.RequeueAfterHelper(requeueAfter, scaleRequeueAfter)
+
+	imagePolicyRequeueAfter, err := r.reconcileImagePolicy(ctx, &app, now)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter = util.RequeueAfterHelper(requeueAfter, imagePolicyRequeueAfter)
+
+	imageDigestRequeueAfter, err := r.reconcileImageDigest(ctx, &app, now)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter = util.RequeueAfterHelper(requeueAfter, imageDigestRequeueAfter)
+
+	// ServiceAccount
+	serviceAccountObject := &corev1.ServiceAccount{
+		ObjectMeta:                   r.serviceAccountAnnotations(app, objectMeta),
+		AutomountServiceAccountToken: r.automountServiceAccountToken(app),
+	}
+
+	// Deployment
+	deploymentObject := r.deploymentObject(r.primaryApp(app), objectMeta)
+	excludeProcesses(deploymentObject.Spec.Selector)
+
+	// Files
+	filesConfigMapObject := r.filesConfigMapObject(app)
+
+	// Service
+	serviceObject := r.serviceObject(app, objectMeta)
+
+	// Ingress
+	ingressObject := r.ingressObject(app, objectMeta)
+
+	if r.serviceAccountCreated(app) {
+		result, err := r.ReconcileResource(app, serviceAccountObject, reconciler.StatePresent)
+		if result != nil || err != nil {
+			return util.ReconcileReturnHelper(result, err)
+		}
+	} else if err := r.removeServiceAccount(ctx, app); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result, err := r.ReconcileGlobalImagePullSecrets(ctx, app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileVolumes(ctx, app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileResource(app, filesConfigMapObject, util.ReconcilerStateHelper(len(app.Spec.Files) > 0))
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcilePreDeployHook(ctx, &app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	// In blue/green and StatefulSet mode, the colour deployments or the stateful set replace the app's deployment
+	if !blueGreenEnabled(app) && !statefulSet(app) {
+		deploymentState, err := r.ReconcileRollout(ctx, &app, deploymentObject)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if preDeployHookPending(app) {
+			deploymentState = preDeployHookState(keepDeploymentTemplate)
+		}
+
+		result, err = r.ReconcileResource(app, deploymentObject, keepDeploymentSelector(deploymentState))
+		if result != nil || err != nil {
+			return util.ReconcileReturnHelper(result, err)
+		}
+	}
+
+	result, err = r.ReconcileProcesses(ctx, app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileCronJobs(ctx, app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileStatefulSet(ctx, app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileBlueGreen(ctx, &app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+	serviceObject.Spec.Selector, err = r.serviceSelector(ctx, app, objectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// @TODO service should always be enabled if ingress is enabled
+	result, err = r.ReconcileResource(app, serviceObject, util.ReconcilerStateHelper(app.Spec.ServiceEnabled))
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileResource(app, ingressObject, util.ReconcilerStateHelper(app.Spec.IngressEnabled))
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	result, err = r.ReconcileCanary(app)
+	if result != nil || err != nil {
+		return util.ReconcileReturnHelper(result, err)
+	}
+
+	app.Status.Canary, err = r.canaryStatus(ctx, app)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	app.Status.CronJobs, err = r.cronJobStatuses(ctx, app)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// reconcileSuspendedStatus reports the observed state of the suspended app's resources, without writing to any of them
+// The status is refreshed the same way as when the app is reconciled, except for anything that would update a resource,
+// such as rolling back a failed rollout or promoting a blue/green colour
+func (r *SimpleAppReconciler) reconcileSuspendedStatus(ctx context.Context, app *webappv1.SimpleApp) (ctrl.Result, error) {
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:               suspendedConditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: app.Generation,
+		Reason:             "Suspended",
+		Message:            "Reconciliation is suspended, the app's resources are not updated",
+	})
+
+	// Requeue at the next scale window change, so the active window stays current
+	requeueAfter := r.reconcileScaleSchedule(app, time.Now())
+
+	if !blueGreenEnabled(*app) && !statefulSet(*app) {
+		if _, err := r.ReconcileRollout(ctx, app, r.deploymentObject(r.primaryApp(*app), r.getObjectMeta(*app))); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	var err error
+	app.Status.BlueGreen, err = r.blueGreenStatus(ctx, *app)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	app.Status.Canary, err = r.canaryStatus(ctx, *app)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	app.Status.CronJobs, err = r.cronJobStatuses(ctx, *app)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// updateStatus writes the app's status, if it changed from the original status
+func (r *SimpleAppReconciler) updateStatus(ctx context.Context, app *webappv1.SimpleApp, originalStatus *webappv1.SimpleAppStatus) error {
+	if equality.Semantic.DeepEqual(originalStatus, &app.Status) {
+		return nil
+	}
+
+	return r.Status().Update(ctx, app)
+}
+
+// deploymentObject returns the desired deployment for the app
+func (r *SimpleAppReconciler) deploymentObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *appsv1.Deployment {
+	return &appsv1.Deployment{
 		ObjectMeta: objectMeta,
 		Spec: appsv1.DeploymentSpec{
-			Replicas: app.Spec.Replicas,
+			Replicas:                r.replicas(app),
+			Strategy:                r.deploymentStrategy(app),
+			MinReadySeconds:         app.Spec.MinReadySeconds,
+			ProgressDeadlineSeconds: app.Spec.ProgressDeadlineSeconds,
+			RevisionHistoryLimit:    app.Spec.RevisionHistoryLimit,
 			Selector: &metav1.LabelSelector{ // @TODO could make this a helper - takes obj meta, returns label selector
 				MatchLabels: objectMeta.Labels,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{ // @TODO could make this a helper - takes obj meta, returns simple obj meta for template
-					Labels: objectMeta.Labels,
+					Labels:      podLabels(objectMeta, webappv1.WorkloadKindDeployment),
+					Annotations: r.podAnnotations(app),
 				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:            app.Name,
-							Image:           app.Spec.Image,
-							ImagePullPolicy: app.Spec.ImagePullPolicy,
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: app.Spec.ContainerPort,
-								},
-							},
-						},
+				Spec: r.podSpec(app, objectMeta),
+			},
+		},
+	}
+}
+
+// podSpec returns the pod spec for the app's pods
+func (r *SimpleAppReconciler) podSpec(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) corev1.PodSpec {
+	return corev1.PodSpec{
+		InitContainers: r.additionalContainers(app, app.Spec.InitContainers),
+		Containers: append([]corev1.Container{
+			{
+				Name:            app.Name,
+				Image:           r.mirrorImage(app.Spec.Image),
+				ImagePullPolicy: app.Spec.ImagePullPolicy,
+				Command:         app.Spec.Command,
+				Args:            app.Spec.Args,
+				WorkingDir:      expandEnv(app.Spec.WorkingDir, app.Spec.Env),
+				Env:             app.Spec.Env,
+				EnvFrom:         app.Spec.EnvFrom,
+				Ports: []corev1.ContainerPort{
+					{
+						ContainerPort: app.Spec.ContainerPort,
 					},
-					ImagePullSecrets: r.namesToLocalObjectRefs(app.Spec.ImagePullSecrets),
 				},
+				Resources:       app.Spec.Resources,
+				SecurityContext: r.containerSecurityContext(app),
+				VolumeMounts:    r.volumeMounts(app),
+				Lifecycle:       r.lifecycle(app),
 			},
-		},
+		}, r.additionalContainers(app, app.Spec.Sidecars)...),
+		TerminationGracePeriodSeconds: r.terminationGracePeriodSeconds(app),
+		Volumes:                       r.volumes(app),
+		SecurityContext:               r.podSecurityContext(app),
+		ImagePullSecrets:              r.imagePullSecrets(app),
+		ServiceAccountName:            r.serviceAccountName(app),
+		AutomountServiceAccountToken:  r.automountServiceAccountToken(app),
+		NodeSelector:                  app.Spec.NodeSelector,
+		Tolerations:                   app.Spec.Tolerations,
+		Affinity:                      app.Spec.Affinity,
+		TopologySpreadConstraints:     r.topologySpreadConstraints(app, objectMeta),
+		PriorityClassName:             app.Spec.PriorityClassName,
 	}
+}
 
-	// Service
-	serviceObject := &corev1.Service{
+// serviceObject returns the desired service for the app, selecting the pods with the object meta's labels
+func (r *SimpleAppReconciler) serviceObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *corev1.Service {
+	return &corev1.Service{
 		ObjectMeta: objectMeta,
 		Spec: corev1.ServiceSpec{
 			Type: corev1.ServiceTypeClusterIP,
@@ -123,9 +412,11 @@ func (r *SimpleAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			Selector: objectMeta.Labels,
 		},
 	}
+}
 
-	// Ingress
-	ingressObject := &networkingv1.Ingress{
+// ingressObject returns the desired ingress for the app
+func (r *SimpleAppReconciler) ingressObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
 		ObjectMeta: r.ingressAnnotations(app, objectMeta),
 		Spec: networkingv1.IngressSpec{
 			Rules: []networkingv1.IngressRule{
@@ -133,7 +424,7 @@ func (r *SimpleAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 					Host: app.Spec.Hostname,
 					IngressRuleValue: networkingv1.IngressRuleValue{
 						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: r.ingressPathsHelper(app),
+							Paths: r.ingressPathsHelper(app, objectMeta.Name),
 						},
 					},
 				},
@@ -146,35 +437,22 @@ func (r *SimpleAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			},
 		},
 	}
-
-	result, err := r.ReconcileResource(app, deploymentObject, reconciler.StatePresent)
-	if result != nil || err != nil {
-		return util.ReconcileReturnHelper(result, err)
-	}
-
-	// @TODO service should always be enabled if ingress is enabled
-	result, err = r.ReconcileResource(app, serviceObject, util.ReconcilerStateHelper(app.Spec.ServiceEnabled))
-	if result != nil || err != nil {
-		return util.ReconcileReturnHelper(result, err)
-	}
-
-	result, err = r.ReconcileResource(app, ingressObject, util.ReconcilerStateHelper(app.Spec.IngressEnabled))
-	if result != nil || err != nil {
-		return util.ReconcileReturnHelper(result, err)
-	}
-
-	return reconcile.Result{}, nil
 }
 
 // ReconcileResource Sets ownership of the resource and then ensures the resource is in the correct state in the cluster
 func (r *SimpleAppReconciler) ReconcileResource(app webappv1.SimpleApp, obj client.Object, state reconciler.DesiredState) (*reconcile.Result, error) {
-	// @TODO this (along with the app) should probably live in some sort of parent reconciler struct
-	resourceReconciler := reconciler.NewReconcilerWith(r.Client, reconciler.WithLog(r.Log))
-
 	err := ctrl.SetControllerReference(&app, obj, r.Scheme)
 	if err != nil {
 		return nil, err
 	}
+	return r.reconcileResource(obj, state)
+}
+
+// reconcileResource ensures the resource is in the correct state in the cluster, without setting ownership
+func (r *SimpleAppReconciler) reconcileResource(obj client.Object, state reconciler.DesiredState) (*reconcile.Result, error) {
+	// @TODO this (along with the app) should probably live in some sort of parent reconciler struct
+	resourceReconciler := reconciler.NewReconcilerWith(r.Client, reconciler.WithLog(r.Log))
+
 	return resourceReconciler.ReconcileResource(obj, state)
 }
 
@@ -195,6 +473,30 @@ func (r *SimpleAppReconciler) labels(app webappv1.SimpleApp) map[string]string {
 	}
 }
 
+// podLabels returns the labels for the pods of a workload of the given kind
+// The app's web pods also get the workload label, which the app's service selects them by, so it doesn't select the app's process pods
+func podLabels(objectMeta metav1.ObjectMeta, kind webappv1.WorkloadKind) map[string]string {
+	labels := map[string]string{}
+	for key, value := range objectMeta.Labels {
+		labels[key] = value
+	}
+
+	if _, ok := labels[processLabelKey]; !ok {
+		labels[workloadLabelKey] = string(kind)
+	}
+
+	return labels
+}
+
+// excludeProcesses adds a requirement to the selector that keeps out the pods of the app's processes,
+// which share the app's type and name labels
+func excludeProcesses(selector *metav1.LabelSelector) {
+	selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      processLabelKey,
+		Operator: metav1.LabelSelectorOpDoesNotExist,
+	})
+}
+
 // namesToLocalObjectRefs returns []LocalObjectReference from []string
 func (r *SimpleAppReconciler) namesToLocalObjectRefs(names []string) []corev1.LocalObjectReference {
 	var refs []corev1.LocalObjectReference
@@ -206,8 +508,167 @@ func (r *SimpleAppReconciler) namesToLocalObjectRefs(names []string) []corev1.Lo
 	return refs
 }
 
-// ingressPathsHelper returns generated ingress paths for the app
-func (r *SimpleAppReconciler) ingressPathsHelper(app webappv1.SimpleApp) []networkingv1.HTTPIngressPath {
+// suspended returns whether reconciliation of the app is suspended, through the spec or the paused annotation
+func suspended(app webappv1.SimpleApp) bool {
+	return app.Spec.Suspend || app.Annotations[pausedAnnotationKey] == "true"
+}
+
+// replicas returns the number of replicas for the app's workloads, taking the scale schedule into account
+func (r *SimpleAppReconciler) replicas(app webappv1.SimpleApp) *int32 {
+	if app.Spec.ScaleToZero {
+		replicas := int32(0)
+		return &replicas
+	}
+
+	if window := activeScaleWindow(app); window != nil {
+		replicas := window.Replicas
+		return &replicas
+	}
+
+	return app.Spec.Replicas
+}
+
+// getDeployment returns the named deployment, or nil if it doesn't exist
+func (r *SimpleAppReconciler) getDeployment(ctx context.Context, namespace string, name string) (*appsv1.Deployment, error) {
+	var deployment appsv1.Deployment
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &deployment); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	return &deployment, nil
+}
+
+// deploymentReady returns whether the deployment has finished rolling out and all of its replicas are ready
+func deploymentReady(deployment appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.ReadyReplicas == replicas
+}
+
+// keepDeploymentSelector wraps the desired state of a deployment, so an existing deployment keeps its selector,
+// which can't be changed
+func keepDeploymentSelector(state reconciler.DesiredState) reconciler.DesiredState {
+	dynamic, ok := state.(reconciler.DynamicDesiredState)
+	if !ok && state != reconciler.StatePresent {
+		return state
+	}
+
+	beforeUpdate := dynamic.BeforeUpdateFunc
+	dynamic.BeforeUpdateFunc = func(current, desired runtime.Object) error {
+		currentDeployment, ok := current.(*appsv1.Deployment)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for current deployment", current)
+		}
+		desiredDeployment, ok := desired.(*appsv1.Deployment)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for desired deployment", desired)
+		}
+
+		desiredDeployment.Spec.Selector = currentDeployment.Spec.Selector
+		if beforeUpdate != nil {
+			return beforeUpdate(current, desired)
+		}
+
+		return nil
+	}
+
+	return dynamic
+}
+
+// deploymentStrategy returns the deployment strategy for the app, or the kubernetes default if not set
+func (r *SimpleAppReconciler) deploymentStrategy(app webappv1.SimpleApp) appsv1.DeploymentStrategy {
+	if app.Spec.Strategy == nil {
+		return appsv1.DeploymentStrategy{}
+	}
+
+	return *app.Spec.Strategy
+}
+
+// volumes returns the volumes for the app's pods
+func (r *SimpleAppReconciler) volumes(app webappv1.SimpleApp) []corev1.Volume {
+	var volumes []corev1.Volume
+
+	for _, volume := range r.sharedVolumes(app) {
+		volumes = append(volumes, corev1.Volume{
+			Name: volume.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: r.volumeClaimName(app, volume),
+				},
+			},
+		})
+	}
+
+	if len(app.Spec.Files) > 0 {
+		volumes = append(volumes, corev1.Volume{
+			Name: filesVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: r.filesConfigMapName(app)},
+				},
+			},
+		})
+	}
+
+	if r.tmpVolumeNeeded(app) {
+		volumes = append(volumes, corev1.Volume{
+			Name: tmpVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	return volumes
+}
+
+// volumeMounts returns the volume mounts for the app's container
+func (r *SimpleAppReconciler) volumeMounts(app webappv1.SimpleApp) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+
+	mounts = append(mounts, volumeSpecMounts(r.sharedVolumes(app))...)
+	mounts = append(mounts, r.filesVolumeMounts(app)...)
+
+	if r.tmpVolumeNeeded(app) {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      tmpVolumeName,
+			MountPath: tmpMountPath,
+		})
+	}
+
+	return mounts
+}
+
+// podAnnotations returns the annotations for the app's pod template
+func (r *SimpleAppReconciler) podAnnotations(app webappv1.SimpleApp) map[string]string {
+	annotations := map[string]string{}
+
+	if len(app.Spec.Files) > 0 {
+		annotations[filesChecksumAnnotationKey] = filesChecksum(app)
+	}
+
+	if app.Spec.RestartedAt != nil {
+		annotations[restartedAtAnnotationKey] = app.Spec.RestartedAt.UTC().Format(time.RFC3339)
+	}
+
+	if app.Status.LastScheduledRestart != nil {
+		annotations[scheduledRestartAnnotationKey] = app.Status.LastScheduledRestart.UTC().Format(time.RFC3339)
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	return annotations
+}
+
+// ingressPathsHelper returns generated ingress paths for the app, routing to the named service
+func (r *SimpleAppReconciler) ingressPathsHelper(app webappv1.SimpleApp, serviceName string) []networkingv1.HTTPIngressPath {
 	var paths []networkingv1.HTTPIngressPath
 
 	prefixType := networkingv1.PathTypePrefix
@@ -218,7 +679,7 @@ func (r *SimpleAppReconciler) ingressPathsHelper(app webappv1.SimpleApp) []netwo
 			PathType: &prefixType,
 			Backend: networkingv1.IngressBackend{
 				Service: &networkingv1.IngressServiceBackend{
-					Name: app.Name,
+					Name: serviceName,
 					Port: networkingv1.ServiceBackendPort{
 						Number: app.Spec.ContainerPort,
 					},
@@ -232,7 +693,11 @@ func (r *SimpleAppReconciler) ingressPathsHelper(app webappv1.SimpleApp) []netwo
 
 func (r *SimpleAppReconciler) ingressAnnotations(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
 	// Start with the global annotations
-	annotations := r.Config.IngressAnnotations
+	// Copied, so the global annotations aren't modified
+	annotations := map[string]string{}
+	for k, v := range r.Config.IngressAnnotations {
+		annotations[k] = v
+	}
 
 	// Then iterate the local annotations and add them to the global annotations
 	// Overwriting any existing keys as we go
@@ -244,8 +709,111 @@ func (r *SimpleAppReconciler) ingressAnnotations(app webappv1.SimpleApp, objectM
 	return objectMeta
 }
 
+// serviceAccountCreated returns whether the operator should create a service account for the app
+func (r *SimpleAppReconciler) serviceAccountCreated(app webappv1.SimpleApp) bool {
+	return app.Spec.ServiceAccount != nil && app.Spec.ServiceAccount.Create
+}
+
+// removeServiceAccount deletes the service account the operator created for the app, if there is one
+// A service account that happens to share the app's name but isn't controlled by the app, such as one created by other tooling, is left alone
+func (r *SimpleAppReconciler) removeServiceAccount(ctx context.Context, app webappv1.SimpleApp) error {
+	var serviceAccount corev1.ServiceAccount
+	if err := r.Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: app.Name}, &serviceAccount); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if !metav1.IsControlledBy(&serviceAccount, &app) {
+		return nil
+	}
+
+	return client.IgnoreNotFound(r.Delete(ctx, &serviceAccount))
+}
+
+// serviceAccountName returns the name of the service account the app's pods run as
+// An empty string means the namespace default service account is used
+func (r *SimpleAppReconciler) serviceAccountName(app webappv1.SimpleApp) string {
+	if app.Spec.ServiceAccount == nil {
+		return ""
+	}
+
+	if app.Spec.ServiceAccount.Create {
+		return app.Name
+	}
+
+	return app.Spec.ServiceAccount.Name
+}
+
+// automountServiceAccountToken returns whether the service account token should be mounted, or nil to leave the cluster default
+func (r *SimpleAppReconciler) automountServiceAccountToken(app webappv1.SimpleApp) *bool {
+	if app.Spec.ServiceAccount == nil {
+		return nil
+	}
+
+	return app.Spec.ServiceAccount.AutomountServiceAccountToken
+}
+
+// serviceAccountAnnotations returns the object meta for the app's service account with the configured annotations
+func (r *SimpleAppReconciler) serviceAccountAnnotations(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
+	if app.Spec.ServiceAccount != nil {
+		objectMeta.Annotations = app.Spec.ServiceAccount.Annotations
+	}
+
+	return objectMeta
+}
+
+// topologySpreadConstraints returns the app's topology spread constraints
+// Falls back to the global default spread across zones and nodes when the app has more than one replica
+func (r *SimpleAppReconciler) topologySpreadConstraints(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) []corev1.TopologySpreadConstraint {
+	if len(app.Spec.TopologySpreadConstraints) > 0 {
+		return app.Spec.TopologySpreadConstraints
+	}
+
+	// Based on the replicas the app runs, which the active scale window sets
+	spread := r.Config.TopologySpread
+	replicas := r.replicas(app)
+	if !spread.Enabled || replicas == nil || *replicas <= 1 {
+		return nil
+	}
+
+	maxSkew := spread.MaxSkew
+	if maxSkew < 1 {
+		maxSkew = 1
+	}
+
+	whenUnsatisfiable := spread.WhenUnsatisfiable
+	if whenUnsatisfiable == "" {
+		whenUnsatisfiable = corev1.ScheduleAnyway
+	}
+
+	selector := &metav1.LabelSelector{MatchLabels: objectMeta.Labels}
+	if _, ok := objectMeta.Labels[processLabelKey]; !ok {
+		excludeProcesses(selector)
+	}
+
+	var constraints []corev1.TopologySpreadConstraint
+	for _, key := range []string{corev1.LabelTopologyZone, corev1.LabelHostname} {
+		constraints = append(constraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       key,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     selector.DeepCopy(),
+		})
+	}
+
+	return constraints
+}
+
 // +kubebuilder:rbac:groups="",resources=services,verbs=*
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=*
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=*
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=*
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=*
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=*
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=*
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=*
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=*
 
 // SetupWithManager sets up the controller with the Manager.
@@ -255,10 +823,64 @@ func (r *SimpleAppReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	r.Log = ctrl.Log.WithName("controllers").WithName("SimpleApp")
 
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&webappv1.SimpleApp{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&batchv1.Job{}).
+		Owns(&batchv1.CronJob{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&corev1.ConfigMap{}).
 		Owns(&networkingv1.Ingress{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &webappv1.SimpleAppClass{}}, handler.EnqueueRequestsFromMapFunc(r.appsForClass)).
+		Watches(&source.Kind{Type: &webappv1.SimpleAppDefaults{}}, handler.EnqueueRequestsFromMapFunc(r.appsForDefaults))
+
+	// Secrets are watched through their own caches, limited to the global image pull secrets and their copies
+	secretSources, err := r.secretSources(mgr)
+	if err != nil {
+		return err
+	}
+	for _, secretSource := range secretSources {
+		builder = builder.Watches(secretSource, handler.EnqueueRequestsFromMapFunc(r.appsForSecret))
+	}
+
+	// Reconcile every app when the config is reloaded
+	if r.ConfigWatcher != nil {
+		builder = builder.Watches(r.ConfigWatcher.Source(), handler.EnqueueRequestsFromMapFunc(r.allApps))
+	}
+
+	return builder.Complete(r)
+}
+
+// withConfig returns a copy of the reconciler with the current config from the config watcher,
+// so the config doesn't change part way through a reconcile
+func (r *SimpleAppReconciler) withConfig() *SimpleAppReconciler {
+	if r.ConfigWatcher == nil {
+		return r
+	}
+
+	reconciler := *r
+	reconciler.Config = r.ConfigWatcher.Config()
+
+	return &reconciler
+}
+
+// allApps returns a request for every app
+func (r *SimpleAppReconciler) allApps(obj client.Object) []reconcile.Request {
+	var apps webappv1.SimpleAppList
+	if err := r.List(context.Background(), &apps); err != nil {
+		r.Log.Error(err, "unable to list apps")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, app := range apps.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+		})
+	}
+
+	return requests
 }
@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// specDefaults are the defaults for the fields of the app's spec, applied under the app's class
+// They aren't CRD defaults, since those are stored on the app and would always take precedence over the class
+var specDefaults = map[string]interface{}{
+	"imagePullPolicy": string(corev1.PullIfNotPresent),
+	"containerPort":   int64(80),
+	"replicas":        int64(1),
+	"workloadKind":    string(webappv1.WorkloadKindDeployment),
+	"serviceEnabled":  true,
+	"servicePort":     int64(80),
+	"ingressEnabled":  true,
+	"ingressPaths":    []interface{}{"/"},
+}
+
+// applyClass merges the spec of the app's class and the spec defaults into the app's spec, with the fields the app sets taking precedence
+// The app and the class are read unstructured, since their typed specs can't tell a field set to false or zero from an unset one
+func (r *SimpleAppReconciler) applyClass(ctx context.Context, app *webappv1.SimpleApp) error {
+	raw := &unstructured.Unstructured{}
+	raw.SetGroupVersionKind(webappv1.GroupVersion.WithKind("SimpleApp"))
+	if err := r.Get(ctx, client.ObjectKeyFromObject(app), raw); err != nil {
+		return err
+	}
+
+	// Use the app as read unstructured throughout, so the merged spec and the app's metadata are from the same version
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, app); err != nil {
+		return err
+	}
+
+	rawSpec, _, err := unstructured.NestedMap(raw.Object, "spec")
+	if err != nil {
+		return err
+	}
+
+	var classSpec map[string]interface{}
+	if app.Spec.ClassName != "" {
+		class := &unstructured.Unstructured{}
+		class.SetGroupVersionKind(webappv1.GroupVersion.WithKind("SimpleAppClass"))
+		if err := r.Get(ctx, client.ObjectKey{Name: app.Spec.ClassName}, class); err != nil {
+			r.Recorder.Eventf(app, corev1.EventTypeWarning, "ClassUnavailable", "Unable to get SimpleAppClass %s: %s", app.Spec.ClassName, err)
+			return fmt.Errorf("unable to get SimpleAppClass %s: %w", app.Spec.ClassName, err)
+		}
+
+		classSpec, _, err = unstructured.NestedMap(class.Object, "spec")
+		if err != nil {
+			return fmt.Errorf("invalid SimpleAppClass %s: %w", app.Spec.ClassName, err)
+		}
+	}
+
+	spec, err := mergeSpec(classSpec, rawSpec)
+	if err != nil {
+		return fmt.Errorf("unable to merge the spec of the app: %w", err)
+	}
+	spec.ClassName = app.Spec.ClassName
+	app.Spec = spec
+
+	return nil
+}
+
+// appsForClass returns a request for each app that uses the class
+func (r *SimpleAppReconciler) appsForClass(obj client.Object) []reconcile.Request {
+	var apps webappv1.SimpleAppList
+	if err := r.List(context.Background(), &apps); err != nil {
+		r.Log.Error(err, "unable to list apps", "class", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, app := range apps.Items {
+		if app.Spec.ClassName != obj.GetName() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+		})
+	}
+
+	return requests
+}
+
+// mergeSpec returns the app spec, as set on the app, merged over the class's spec and the spec defaults
+// Objects and maps are merged key by key, and any other value the app sets, including false and zero, replaces the class's
+func mergeSpec(class map[string]interface{}, spec map[string]interface{}) (webappv1.SimpleAppSpec, error) {
+	var merged webappv1.SimpleAppSpec
+
+	data, err := json.Marshal(mergeValues(mergeValues(specDefaults, class), spec))
+	if err != nil {
+		return merged, err
+	}
+
+	err = json.Unmarshal(data, &merged)
+
+	return merged, err
+}
+
+// mergeValues merges the JSON values over the defaults, recursing into objects set in both
+func mergeValues(defaults map[string]interface{}, values map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range defaults {
+		merged[key] = value
+	}
+
+	for key, value := range values {
+		defaultObject, defaultIsObject := merged[key].(map[string]interface{})
+		object, isObject := value.(map[string]interface{})
+		if defaultIsObject && isObject {
+			merged[key] = mergeValues(defaultObject, object)
+			continue
+		}
+
+		merged[key] = value
+	}
+
+	return merged
+}
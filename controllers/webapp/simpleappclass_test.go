@@ -0,0 +1,165 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMergeSpecAppFalseOverridesClass(t *testing.T) {
+	class := map[string]interface{}{
+		"ingressEnabled":          true,
+		"serviceEnabled":          true,
+		"suspend":                 true,
+		"autoRollback":            true,
+		"disableSecurityBaseline": true,
+		"pinImageDigest":          true,
+		"minReadySeconds":         int64(10),
+	}
+	app := map[string]interface{}{
+		"image":                   "nginx",
+		"ingressEnabled":          false,
+		"serviceEnabled":          false,
+		"suspend":                 false,
+		"autoRollback":            false,
+		"disableSecurityBaseline": false,
+		"pinImageDigest":          false,
+		"minReadySeconds":         int64(0),
+	}
+
+	merged, err := mergeSpec(class, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.IngressEnabled || merged.ServiceEnabled || merged.Suspend || merged.AutoRollback ||
+		merged.DisableSecurityBaseline || merged.PinImageDigest {
+		t.Errorf("expected the app's false values to win, got %+v", merged)
+	}
+	if merged.MinReadySeconds != 0 {
+		t.Errorf("expected the app's minReadySeconds 0 to win, got %d", merged.MinReadySeconds)
+	}
+	if merged.Image != "nginx" {
+		t.Errorf("expected image nginx, got %q", merged.Image)
+	}
+}
+
+func TestMergeSpecClassFillsUnsetFields(t *testing.T) {
+	class := map[string]interface{}{
+		"autoRollback":    true,
+		"minReadySeconds": int64(10),
+		"nodeSelector":    map[string]interface{}{"pool": "web"},
+		"env":             []interface{}{map[string]interface{}{"name": "CLASS", "value": "1"}},
+	}
+	app := map[string]interface{}{
+		"image": "nginx",
+	}
+
+	merged, err := mergeSpec(class, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !merged.AutoRollback || merged.MinReadySeconds != 10 {
+		t.Errorf("expected the class's values for fields the app leaves unset, got %+v", merged)
+	}
+	if merged.NodeSelector["pool"] != "web" {
+		t.Errorf("expected the class's node selector, got %v", merged.NodeSelector)
+	}
+	if len(merged.Env) != 1 || merged.Env[0].Name != "CLASS" {
+		t.Errorf("expected the class's env, got %v", merged.Env)
+	}
+}
+
+func TestMergeSpecMapsMergeAndListsReplace(t *testing.T) {
+	class := map[string]interface{}{
+		"ingressAnnotations": map[string]interface{}{"a": "class", "b": "class"},
+		"env":                []interface{}{map[string]interface{}{"name": "CLASS", "value": "1"}},
+		"securityContext":    map[string]interface{}{"runAsUser": int64(1000)},
+	}
+	app := map[string]interface{}{
+		"ingressAnnotations": map[string]interface{}{"b": "app"},
+		"env":                []interface{}{map[string]interface{}{"name": "APP", "value": "1"}},
+		"securityContext":    map[string]interface{}{"runAsGroup": int64(2000)},
+	}
+
+	merged, err := mergeSpec(class, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.IngressAnnotations["a"] != "class" || merged.IngressAnnotations["b"] != "app" {
+		t.Errorf("expected the annotations to merge key by key, got %v", merged.IngressAnnotations)
+	}
+	if len(merged.Env) != 1 || merged.Env[0].Name != "APP" {
+		t.Errorf("expected the app's env to replace the class's, got %v", merged.Env)
+	}
+	if merged.SecurityContext == nil || merged.SecurityContext.RunAsUser == nil || *merged.SecurityContext.RunAsUser != 1000 ||
+		merged.SecurityContext.RunAsGroup == nil || *merged.SecurityContext.RunAsGroup != 2000 {
+		t.Errorf("expected the security context to merge field by field, got %+v", merged.SecurityContext)
+	}
+}
+
+func TestMergeSpecClassOverridesSpecDefaults(t *testing.T) {
+	class := map[string]interface{}{
+		"replicas":       int64(3),
+		"containerPort":  int64(8080),
+		"ingressEnabled": false,
+		"ingressPaths":   []interface{}{"/api"},
+	}
+	app := map[string]interface{}{
+		"image": "nginx",
+	}
+
+	merged, err := mergeSpec(class, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.Replicas == nil || *merged.Replicas != 3 || merged.ContainerPort != 8080 || merged.IngressEnabled {
+		t.Errorf("expected the class's values over the spec defaults, got %+v", merged)
+	}
+	if len(merged.IngressPaths) != 1 || merged.IngressPaths[0] != "/api" {
+		t.Errorf("expected the class's ingress paths, got %v", merged.IngressPaths)
+	}
+	if !merged.ServiceEnabled || merged.ServicePort != 80 || merged.ImagePullPolicy != corev1.PullIfNotPresent ||
+		merged.WorkloadKind != webappv1.WorkloadKindDeployment {
+		t.Errorf("expected the spec defaults for fields neither sets, got %+v", merged)
+	}
+}
+
+func TestMergeSpecDefaultsWithoutClass(t *testing.T) {
+	app := map[string]interface{}{
+		"image":          "nginx",
+		"serviceEnabled": false,
+	}
+
+	merged, err := mergeSpec(nil, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.ServiceEnabled {
+		t.Errorf("expected the app's serviceEnabled false to win over the default")
+	}
+	if merged.Replicas == nil || *merged.Replicas != 1 || !merged.IngressEnabled || len(merged.IngressPaths) != 1 {
+		t.Errorf("expected the spec defaults, got %+v", merged)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// applyDefaults applies the namespace's SimpleAppDefaults to the fields the app (and its class) leave unset
+func (r *SimpleAppReconciler) applyDefaults(ctx context.Context, app *webappv1.SimpleApp) error {
+	var defaults webappv1.SimpleAppDefaultsList
+	if err := r.List(ctx, &defaults, client.InNamespace(app.Namespace)); err != nil {
+		return fmt.Errorf("unable to list SimpleAppDefaults: %w", err)
+	}
+
+	// Only unset fields are filled, so applying in reverse order of name gives the later names precedence
+	sort.Slice(defaults.Items, func(i, j int) bool {
+		return defaults.Items[i].Name > defaults.Items[j].Name
+	})
+
+	for _, item := range defaults.Items {
+		applyDefaultsSpec(app, item.Spec)
+	}
+
+	return nil
+}
+
+// applyDefaultsSpec fills the fields of the app's spec that are unset from the defaults
+func applyDefaultsSpec(app *webappv1.SimpleApp, defaults webappv1.SimpleAppDefaultsSpec) {
+	if len(defaults.IngressAnnotations) > 0 {
+		annotations := map[string]string{}
+		for key, value := range defaults.IngressAnnotations {
+			annotations[key] = value
+		}
+		for key, value := range app.Spec.IngressAnnotations {
+			annotations[key] = value
+		}
+		app.Spec.IngressAnnotations = annotations
+	}
+
+	if resourcesEmpty(app.Spec.Resources) {
+		app.Spec.Resources = *defaults.Resources.DeepCopy()
+	}
+	for _, containers := range [][]webappv1.ContainerSpec{app.Spec.InitContainers, app.Spec.Sidecars} {
+		for i := range containers {
+			if resourcesEmpty(containers[i].Resources) {
+				containers[i].Resources = *defaults.Resources.DeepCopy()
+			}
+		}
+	}
+	for name, process := range app.Spec.Processes {
+		if resourcesEmpty(process.Resources) {
+			process.Resources = *defaults.Resources.DeepCopy()
+			app.Spec.Processes[name] = process
+		}
+	}
+
+	if app.Spec.Hostname == "" && defaults.HostnameSuffix != "" {
+		app.Spec.Hostname = fmt.Sprintf("%s.%s", app.Name, defaults.HostnameSuffix)
+	}
+
+	for _, name := range defaults.ImagePullSecrets {
+		found := false
+		for _, existing := range app.Spec.ImagePullSecrets {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			app.Spec.ImagePullSecrets = append(app.Spec.ImagePullSecrets, name)
+		}
+	}
+}
+
+// resourcesEmpty returns whether no compute resources are requested or limited
+func resourcesEmpty(resources corev1.ResourceRequirements) bool {
+	return len(resources.Requests) == 0 && len(resources.Limits) == 0
+}
+
+// appsForDefaults returns a request for each app in the namespace of the defaults
+func (r *SimpleAppReconciler) appsForDefaults(obj client.Object) []reconcile.Request {
+	var apps webappv1.SimpleAppList
+	if err := r.List(context.Background(), &apps, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list apps", "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, app := range apps.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: app.Namespace, Name: app.Name},
+		})
+	}
+
+	return requests
+}
@@ -0,0 +1,313 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	"github.com/cmmarslender/web-operator/pkg/configfile"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// jobNameLabelKey is set on a job's pods by the job controller
+	jobNameLabelKey = "job-name"
+)
+
+// SimpleAppTaskReconciler reconciles a SimpleAppTask object
+type SimpleAppTaskReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Config   *configv1.Config
+	Recorder record.EventRecorder
+
+	// ConfigWatcher reloads the config from its file. If set, tasks start with the config current at the time
+	ConfigWatcher *configfile.Watcher
+}
+
+//+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleapptasks,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleapptasks/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=webapp.k8s.cmm.io,resources=simpleapptasks/finalizers,verbs=update
+
+// Reconcile runs the task's command in a job with the image and configuration of the task's app,
+// records the outcome in the task's status, and deletes the task once its TTL after finishing expires
+func (r *SimpleAppTaskReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.Log.Info(fmt.Sprintf("SimpleAppTask name is %s", req.NamespacedName))
+
+	var task webappv1.SimpleAppTask
+	if err := r.Get(ctx, req.NamespacedName, &task); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	originalStatus := task.Status.DeepCopy()
+
+	if task.Status.CompletionTime != nil {
+		return r.reconcileTTL(ctx, task)
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: task.Namespace, Name: task.Name}, job)
+	if client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case errors.IsNotFound(err) && task.Status.JobName != "":
+		// The job is never recreated, so the command doesn't run twice
+		r.finish(&task, webappv1.JobPhaseFailed, fmt.Sprintf("Job %s was deleted before it finished", task.Status.JobName))
+	case errors.IsNotFound(err):
+		if err := r.startJob(ctx, &task); err != nil {
+			return ctrl.Result{}, err
+		}
+	default:
+		if err := r.observeJob(ctx, &task, *job); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.updateStatus(ctx, &task, originalStatus); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if task.Status.CompletionTime != nil {
+		return r.reconcileTTL(ctx, task)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// startJob creates the task's job from the task's app, or marks the task pending if the app doesn't exist
+func (r *SimpleAppTaskReconciler) startJob(ctx context.Context, task *webappv1.SimpleAppTask) error {
+	var app webappv1.SimpleApp
+	err := r.Get(ctx, types.NamespacedName{Namespace: task.Namespace, Name: task.Spec.AppName}, &app)
+	if errors.IsNotFound(err) {
+		task.Status.Phase = webappv1.JobPhasePending
+		task.Status.Message = fmt.Sprintf("SimpleApp %s was not found", task.Spec.AppName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	apps := r.appReconciler()
+	if err := apps.applyClass(ctx, &app); err != nil {
+		return err
+	}
+	if err := apps.applyDefaults(ctx, &app); err != nil {
+		return err
+	}
+
+	jobObject := r.jobObject(apps, *task, apps.primaryApp(app))
+	if err := ctrl.SetControllerReference(task, jobObject, r.Scheme); err != nil {
+		return err
+	}
+
+	result, err := apps.reconcileResource(jobObject, reconciler.StatePresent)
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		return fmt.Errorf("job %s was not created", jobObject.Name)
+	}
+
+	now := metav1.Now()
+	task.Status.Phase = webappv1.JobPhaseRunning
+	task.Status.Image = jobObject.Spec.Template.Spec.Containers[0].Image
+	task.Status.JobName = jobObject.Name
+	task.Status.StartTime = &now
+	task.Status.Message = fmt.Sprintf("Job %s is running", jobObject.Name)
+	r.Recorder.Eventf(task, corev1.EventTypeNormal, "Started", "Started job %s with image %s", jobObject.Name, task.Status.Image)
+
+	return nil
+}
+
+// observeJob records the state of the task's job and its latest pod in the task's status
+func (r *SimpleAppTaskReconciler) observeJob(ctx context.Context, task *webappv1.SimpleAppTask, job batchv1.Job) error {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{jobNameLabelKey: job.Name}); err != nil {
+		return err
+	}
+
+	var latest *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+
+	if latest != nil {
+		task.Status.PodName = latest.Name
+		task.Status.ExitCode = exitCode(*latest, job.Spec.Template.Spec.Containers[0].Name)
+	}
+
+	phase, message := jobPhase(job)
+	if phase == webappv1.JobPhaseRunning {
+		task.Status.Phase = phase
+		task.Status.Message = message
+		return nil
+	}
+
+	r.finish(task, phase, message)
+	return nil
+}
+
+// finish marks the task as finished with the given phase
+func (r *SimpleAppTaskReconciler) finish(task *webappv1.SimpleAppTask, phase webappv1.JobPhase, message string) {
+	now := metav1.Now()
+	task.Status.Phase = phase
+	task.Status.Message = message
+	task.Status.CompletionTime = &now
+
+	if phase == webappv1.JobPhaseSucceeded {
+		r.Recorder.Event(task, corev1.EventTypeNormal, "Succeeded", message)
+	} else {
+		r.Recorder.Event(task, corev1.EventTypeWarning, "Failed", message)
+	}
+}
+
+// reconcileTTL deletes the finished task once its TTL expires, or requeues the task for when it does
+// The task's job and pods are garbage collected along with the task
+func (r *SimpleAppTaskReconciler) reconcileTTL(ctx context.Context, task webappv1.SimpleAppTask) (ctrl.Result, error) {
+	if task.Spec.TTLSecondsAfterFinished == nil {
+		return ctrl.Result{}, nil
+	}
+
+	expiry := task.Status.CompletionTime.Add(time.Duration(*task.Spec.TTLSecondsAfterFinished) * time.Second)
+	if remaining := time.Until(expiry); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+
+	err := r.Delete(ctx, &task, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	return ctrl.Result{}, client.IgnoreNotFound(err)
+}
+
+// updateStatus writes the task's status, if it changed from the original status
+func (r *SimpleAppTaskReconciler) updateStatus(ctx context.Context, task *webappv1.SimpleAppTask, originalStatus *webappv1.SimpleAppTaskStatus) error {
+	if equality.Semantic.DeepEqual(originalStatus, &task.Status) {
+		return nil
+	}
+
+	return r.Status().Update(ctx, task)
+}
+
+// appReconciler returns an app reconciler to build the task's resources from its app with, using the current config
+func (r *SimpleAppTaskReconciler) appReconciler() *SimpleAppReconciler {
+	apps := &SimpleAppReconciler{
+		Client:        r.Client,
+		Log:           r.Log,
+		Scheme:        r.Scheme,
+		Config:        r.Config,
+		Recorder:      r.Recorder,
+		ConfigWatcher: r.ConfigWatcher,
+	}
+
+	return apps.withConfig()
+}
+
+// jobObject returns the desired job for the task, running the task's command in the app's container
+// The pod spec is built by the same app reconciler the app was resolved with, so both use the same config
+// The job's pods get the task's name label, so they aren't selected by the app's service
+func (r *SimpleAppTaskReconciler) jobObject(apps *SimpleAppReconciler, task webappv1.SimpleAppTask, app webappv1.SimpleApp) *batchv1.Job {
+	objectMeta := metav1.ObjectMeta{
+		Namespace: task.Namespace,
+		Name:      task.Name,
+		Labels: map[string]string{
+			typeLabelKey: task.Kind,
+			nameLabelKey: task.Name,
+		},
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: objectMeta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          task.Spec.BackoffLimit,
+			ActiveDeadlineSeconds: task.Spec.ActiveDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: objectMeta.Labels,
+				},
+				Spec: apps.commandPodSpec(app, objectMeta, task.Spec.Command, task.Spec.Args),
+			},
+		},
+	}
+}
+
+// tasksForApp returns reconcile requests for the pending tasks of the app, so they start once the app exists
+func (r *SimpleAppTaskReconciler) tasksForApp(obj client.Object) []reconcile.Request {
+	var tasks webappv1.SimpleAppTaskList
+	if err := r.List(context.Background(), &tasks, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list tasks", "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, task := range tasks.Items {
+		if task.Spec.AppName != obj.GetName() || task.Status.JobName != "" {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: task.Namespace, Name: task.Name},
+		})
+	}
+
+	return requests
+}
+
+// exitCode returns the exit code of the pod's container, or nil if the container hasn't exited
+func exitCode(pod corev1.Pod, container string) *int32 {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container && status.State.Terminated != nil {
+			exitCode := status.State.Terminated.ExitCode
+			return &exitCode
+		}
+	}
+
+	return nil
+}
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SimpleAppTaskReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Log = ctrl.Log.WithName("controllers").WithName("SimpleAppTask")
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&webappv1.SimpleAppTask{}).
+		Owns(&batchv1.Job{}).
+		Watches(&source.Kind{Type: &webappv1.SimpleApp{}}, handler.EnqueueRequestsFromMapFunc(r.tasksForApp)).
+		Complete(r)
+}
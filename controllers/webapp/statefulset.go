@@ -0,0 +1,249 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReconcileStatefulSet ensures the app's stateful set and its headless governing service exist in StatefulSet mode
+// When switching between modes, the old workload keeps serving traffic until the new workload is ready,
+// and is removed once the app's service has moved to the new workload's pods
+func (r *SimpleAppReconciler) ReconcileStatefulSet(ctx context.Context, app webappv1.SimpleApp) (*reconcile.Result, error) {
+	objectMeta := r.getObjectMeta(app)
+	statefulSetObject := r.statefulSetObject(r.primaryApp(app), objectMeta)
+	headlessServiceObject := r.headlessServiceObject(app, objectMeta)
+
+	if !statefulSet(app) {
+		ready, err := r.workloadReady(ctx, app)
+		if err != nil || !ready {
+			return nil, err
+		}
+		left, err := r.serviceLeftWorkload(ctx, app, webappv1.WorkloadKindStatefulSet)
+		if err != nil || !left {
+			return nil, err
+		}
+
+		result, err := r.ReconcileResource(app, statefulSetObject, reconciler.StateAbsent)
+		if result != nil || err != nil {
+			return result, err
+		}
+
+		return r.ReconcileResource(app, headlessServiceObject, reconciler.StateAbsent)
+	}
+
+	result, err := r.ReconcileResource(app, headlessServiceObject, reconciler.StatePresent)
+	if result != nil || err != nil {
+		return result, err
+	}
+
+	state := reconciler.DesiredState(reconciler.DynamicDesiredState{BeforeUpdateFunc: statefulSetBeforeUpdate(false)})
+	if preDeployHookPending(app) {
+		state = preDeployHookState(statefulSetBeforeUpdate(true))
+	}
+
+	result, err = r.ReconcileResource(app, statefulSetObject, state)
+	if result != nil || err != nil {
+		return result, err
+	}
+
+	ready, err := r.workloadReady(ctx, app)
+	if err != nil || !ready {
+		return nil, err
+	}
+	left, err := r.serviceLeftWorkload(ctx, app, webappv1.WorkloadKindDeployment)
+	if err != nil || !left {
+		return nil, err
+	}
+
+	return r.ReconcileResource(app, r.deploymentObject(app, objectMeta), reconciler.StateAbsent)
+}
+
+// statefulSet returns whether the app runs in StatefulSet mode
+func statefulSet(app webappv1.SimpleApp) bool {
+	return app.Spec.WorkloadKind == webappv1.WorkloadKindStatefulSet
+}
+
+// workloadReady returns whether the workload for the app's mode is ready:
+// the stateful set in StatefulSet mode, the active colour in blue/green mode, or else the app's deployment
+func (r *SimpleAppReconciler) workloadReady(ctx context.Context, app webappv1.SimpleApp) (bool, error) {
+	switch {
+	case statefulSet(app):
+		current, err := r.getStatefulSet(ctx, app.Namespace, app.Name)
+		return current != nil && statefulSetReady(*current), err
+	case blueGreenEnabled(app):
+		current, err := r.getDeployment(ctx, app.Namespace, r.colorObjectMeta(app, r.activeColor(app)).Name)
+		return current != nil && deploymentReady(*current), err
+	default:
+		current, err := r.getDeployment(ctx, app.Namespace, app.Name)
+		return current != nil && deploymentReady(*current), err
+	}
+}
+
+// webPodsReady returns whether the workload of the given kind that runs the app's web pods is ready,
+// and its pods have the workload label
+func (r *SimpleAppReconciler) webPodsReady(ctx context.Context, app webappv1.SimpleApp, kind webappv1.WorkloadKind) (bool, error) {
+	if kind == webappv1.WorkloadKindStatefulSet {
+		current, err := r.getStatefulSet(ctx, app.Namespace, app.Name)
+		return current != nil && statefulSetReady(*current) && current.Spec.Template.Labels[workloadLabelKey] == string(kind), err
+	}
+
+	current, err := r.getDeployment(ctx, app.Namespace, app.Name)
+	return current != nil && deploymentReady(*current) && current.Spec.Template.Labels[workloadLabelKey] == string(kind), err
+}
+
+// serviceLeftWorkload returns whether the app's service no longer selects the pods of the workload of the given kind,
+// so the workload can be removed without dropping traffic
+func (r *SimpleAppReconciler) serviceLeftWorkload(ctx context.Context, app webappv1.SimpleApp, kind webappv1.WorkloadKind) (bool, error) {
+	var service corev1.Service
+	if err := r.Get(ctx, client.ObjectKey{Namespace: app.Namespace, Name: app.Name}, &service); err != nil {
+		return errors.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+
+	selector := service.Spec.Selector
+	return selector[colorLabelKey] != "" || (selector[workloadLabelKey] != "" && selector[workloadLabelKey] != string(kind)), nil
+}
+
+// statefulSetObject returns the desired stateful set for the app
+// Each replica gets its own claims for the app's volumes, which are mounted in all of the pod's containers
+func (r *SimpleAppReconciler) statefulSetObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *appsv1.StatefulSet {
+	podSpec := r.podSpec(app, objectMeta)
+
+	mounts := volumeSpecMounts(app.Spec.Volumes)
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].VolumeMounts = append(podSpec.InitContainers[i].VolumeMounts, mounts...)
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, mounts...)
+	}
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: objectMeta,
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:             r.replicas(app),
+			ServiceName:          r.headlessServiceName(app),
+			RevisionHistoryLimit: app.Spec.RevisionHistoryLimit,
+			// The workload label keeps the stateful set's pods apart from the app's deployment pods while switching modes
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabels(objectMeta, webappv1.WorkloadKindStatefulSet),
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      podLabels(objectMeta, webappv1.WorkloadKindStatefulSet),
+					Annotations: r.podAnnotations(app),
+				},
+				Spec: podSpec,
+			},
+			VolumeClaimTemplates: r.volumeClaimTemplates(app),
+		},
+	}
+}
+
+// volumeClaimTemplates returns the stateful set's volume claim templates for the app's volumes
+// The claims are named <volume>-<app>-<ordinal> by the stateful set, and are kept when the stateful set is removed
+func (r *SimpleAppReconciler) volumeClaimTemplates(app webappv1.SimpleApp) []corev1.PersistentVolumeClaim {
+	var templates []corev1.PersistentVolumeClaim
+
+	for _, volume := range app.Spec.Volumes {
+		claim := r.persistentVolumeClaimObject(app, volume)
+		claim.ObjectMeta = metav1.ObjectMeta{
+			Name:   volume.Name,
+			Labels: claim.Labels,
+		}
+
+		templates = append(templates, *claim)
+	}
+
+	return templates
+}
+
+// headlessServiceName returns the name of the app's headless governing service
+func (r *SimpleAppReconciler) headlessServiceName(app webappv1.SimpleApp) string {
+	return fmt.Sprintf("%s-headless", app.Name)
+}
+
+// headlessServiceObject returns the desired headless governing service for the app's stateful set,
+// which gives each replica a stable DNS name
+func (r *SimpleAppReconciler) headlessServiceObject(app webappv1.SimpleApp, objectMeta metav1.ObjectMeta) *corev1.Service {
+	headlessMeta := r.getObjectMeta(app)
+	headlessMeta.Name = r.headlessServiceName(app)
+
+	service := r.serviceObject(app, headlessMeta)
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.Selector = podLabels(objectMeta, webappv1.WorkloadKindStatefulSet)
+
+	return service
+}
+
+// getStatefulSet returns the stateful set with the given name, or nil if it doesn't exist
+func (r *SimpleAppReconciler) getStatefulSet(ctx context.Context, namespace string, name string) (*appsv1.StatefulSet, error) {
+	var statefulSet appsv1.StatefulSet
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &statefulSet); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	return &statefulSet, nil
+}
+
+// statefulSetReady returns whether the stateful set has finished rolling out and all of its replicas are ready
+func statefulSetReady(statefulSet appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	return statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+		statefulSet.Status.UpdatedReplicas == replicas &&
+		statefulSet.Status.ReadyReplicas == replicas
+}
+
+// statefulSetBeforeUpdate returns a function that keeps the fields of the current stateful set that can't be changed,
+// and with keepTemplate, the current pod template as well
+func statefulSetBeforeUpdate(keepTemplate bool) func(current, desired runtime.Object) error {
+	return func(current, desired runtime.Object) error {
+		currentStatefulSet, ok := current.(*appsv1.StatefulSet)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for current stateful set", current)
+		}
+		desiredStatefulSet, ok := desired.(*appsv1.StatefulSet)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for desired stateful set", desired)
+		}
+
+		desiredStatefulSet.Spec.Selector = currentStatefulSet.Spec.Selector
+		desiredStatefulSet.Spec.ServiceName = currentStatefulSet.Spec.ServiceName
+		desiredStatefulSet.Spec.VolumeClaimTemplates = currentStatefulSet.Spec.VolumeClaimTemplates
+		if keepTemplate {
+			restarts := desiredStatefulSet.Spec.Template.Annotations
+			desiredStatefulSet.Spec.Template = *currentStatefulSet.Spec.Template.DeepCopy()
+			keepRestartAnnotations(&desiredStatefulSet.Spec.Template, restarts)
+		}
+
+		return nil
+	}
+}
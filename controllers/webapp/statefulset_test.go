@@ -0,0 +1,85 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStatefulSetSelectsOnlyItsPods(t *testing.T) {
+	r := &SimpleAppReconciler{Config: &configv1.Config{}}
+	app := webappv1.SimpleApp{
+		TypeMeta:   metav1.TypeMeta{Kind: "SimpleApp"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+	}
+	objectMeta := r.getObjectMeta(app)
+
+	selector := r.statefulSetObject(app, objectMeta).Spec.Selector.MatchLabels
+	if selector[workloadLabelKey] != string(webappv1.WorkloadKindStatefulSet) {
+		t.Errorf("expected the stateful set to select its pods by the workload label, got %v", selector)
+	}
+
+	deploymentPods := r.deploymentObject(app, objectMeta).Spec.Template.Labels
+	if deploymentPods[workloadLabelKey] != string(webappv1.WorkloadKindDeployment) {
+		t.Errorf("expected the deployment's pods to have their own workload label, got %v", deploymentPods)
+	}
+}
+
+func TestServiceLeftWorkload(t *testing.T) {
+	app := webappv1.SimpleApp{
+		TypeMeta:   metav1.TypeMeta{Kind: "SimpleApp"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+	}
+
+	tests := []struct {
+		name     string
+		selector map[string]string
+		left     bool
+	}{
+		{"no service", nil, true},
+		{"both workloads", map[string]string{typeLabelKey: "SimpleApp", nameLabelKey: "app"}, false},
+		{"old workload", map[string]string{typeLabelKey: "SimpleApp", nameLabelKey: "app", workloadLabelKey: "Deployment"}, false},
+		{"new workload", map[string]string{typeLabelKey: "SimpleApp", nameLabelKey: "app", workloadLabelKey: "StatefulSet"}, true},
+	}
+
+	for _, test := range tests {
+		builder := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme)
+		if test.selector != nil {
+			builder = builder.WithObjects(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+				Spec:       corev1.ServiceSpec{Selector: test.selector},
+			})
+		}
+		r := &SimpleAppReconciler{Client: builder.Build()}
+
+		left, err := r.serviceLeftWorkload(context.Background(), app, webappv1.WorkloadKindDeployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left != test.left {
+			t.Errorf("%s: expected %t, got %t", test.name, test.left, left)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/banzaicloud/operator-tools/pkg/reconciler"
+	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReconcileVolumes ensures the app's persistent volume claims exist
+// Claims that were removed from the app are deleted, unless they are retained
+// In StatefulSet mode, the stateful set creates the claims from its volume claim templates instead
+func (r *SimpleAppReconciler) ReconcileVolumes(ctx context.Context, app webappv1.SimpleApp) (*reconcile.Result, error) {
+	desired := map[string]bool{}
+
+	for _, volume := range r.sharedVolumes(app) {
+		claimObject := r.persistentVolumeClaimObject(app, volume)
+		desired[claimObject.Name] = true
+
+		// Retained claims must not be garbage collected along with the app, so they get no owner reference
+		if !retainVolume(volume) {
+			if err := ctrl.SetControllerReference(&app, claimObject, r.Scheme); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := r.reconcileResource(claimObject, reconciler.DynamicDesiredState{
+			BeforeUpdateFunc: persistentVolumeClaimBeforeUpdate,
+		})
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	// When switching to StatefulSet mode, the app's deployments keep serving from the shared claims until the stateful set
+	// is ready, so the claims are kept until the deployments are gone
+	if statefulSet(app) {
+		running, err := r.deploymentsRunning(ctx, app)
+		if err != nil || running {
+			return nil, err
+		}
+	}
+
+	var claims corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &claims, client.InNamespace(app.Namespace), client.MatchingLabels(r.labels(app))); err != nil {
+		return nil, err
+	}
+
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if desired[claim.Name] || !metav1.IsControlledBy(claim, &app) {
+			continue
+		}
+
+		if err := r.Delete(ctx, claim); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// deploymentsRunning returns whether the app's deployment or any of its colour deployments still exist
+func (r *SimpleAppReconciler) deploymentsRunning(ctx context.Context, app webappv1.SimpleApp) (bool, error) {
+	names := []string{app.Name}
+	for _, color := range colors {
+		names = append(names, r.colorObjectMeta(app, color).Name)
+	}
+
+	for _, name := range names {
+		deployment, err := r.getDeployment(ctx, app.Namespace, name)
+		if err != nil || deployment != nil {
+			return deployment != nil, err
+		}
+	}
+
+	return false, nil
+}
+
+// persistentVolumeClaimObject returns the desired persistent volume claim for the app's volume
+func (r *SimpleAppReconciler) persistentVolumeClaimObject(app webappv1.SimpleApp, volume webappv1.VolumeSpec) *corev1.PersistentVolumeClaim {
+	objectMeta := r.getObjectMeta(app)
+	objectMeta.Name = r.volumeClaimName(app, volume)
+	objectMeta.Labels[volumeLabelKey] = volume.Name
+
+	accessModes := volume.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: objectMeta,
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      accessModes,
+			StorageClassName: volume.StorageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: volume.Size,
+				},
+			},
+		},
+	}
+}
+
+// persistentVolumeClaimBeforeUpdate keeps the current claim spec, since most of it is immutable once bound
+// Only increases to the requested size are carried over to the claim
+func persistentVolumeClaimBeforeUpdate(current, desired runtime.Object) error {
+	currentClaim, ok := current.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for current persistent volume claim", current)
+	}
+	desiredClaim, ok := desired.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for desired persistent volume claim", desired)
+	}
+
+	size := desiredClaim.Spec.Resources.Requests[corev1.ResourceStorage]
+
+	desiredClaim.Spec = *currentClaim.Spec.DeepCopy()
+	if desiredClaim.Spec.Resources.Requests == nil {
+		desiredClaim.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	if size.Cmp(desiredClaim.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+		desiredClaim.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	}
+
+	// Keep finalizers such as kubernetes.io/pvc-protection, which aren't part of the desired state
+	desiredClaim.Finalizers = currentClaim.Finalizers
+
+	return nil
+}
+
+// volumeClaimName returns the name of the persistent volume claim for the app's volume
+func (r *SimpleAppReconciler) volumeClaimName(app webappv1.SimpleApp, volume webappv1.VolumeSpec) string {
+	return fmt.Sprintf("%s-%s", app.Name, volume.Name)
+}
+
+// retainVolume returns whether the volume's claim is kept when the volume or the app is deleted
+func retainVolume(volume webappv1.VolumeSpec) bool {
+	return volume.RetainOnDelete == nil || *volume.RetainOnDelete
+}
+
+// sharedVolumes returns the app's volumes that are backed by a single claim shared by all of the app's pods
+// In StatefulSet mode, each replica gets its own claims, so there are none
+func (r *SimpleAppReconciler) sharedVolumes(app webappv1.SimpleApp) []webappv1.VolumeSpec {
+	if statefulSet(app) {
+		return nil
+	}
+
+	return app.Spec.Volumes
+}
+
+// volumeSpecMounts returns the volume mounts for the volumes
+func volumeSpecMounts(volumes []webappv1.VolumeSpec) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+
+	for _, volume := range volumes {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: volume.MountPath,
+		})
+	}
+
+	return mounts
+}
@@ -3,11 +3,13 @@ module github.com/cmmarslender/web-operator
 go 1.16
 
 require (
+	github.com/Masterminds/semver/v3 v3.1.1
 	github.com/banzaicloud/k8s-objectmatcher v1.5.1
 	github.com/banzaicloud/operator-tools v0.25.0
 	github.com/go-logr/logr v0.4.0
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.14.0
+	github.com/robfig/cron/v3 v3.0.1
 	k8s.io/api v0.21.3
 	k8s.io/apimachinery v0.21.3
 	k8s.io/client-go v0.21.3
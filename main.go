@@ -24,16 +24,22 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
 	webappv1 "github.com/cmmarslender/web-operator/apis/webapp/v1"
 	controllers "github.com/cmmarslender/web-operator/controllers/webapp"
+	"github.com/cmmarslender/web-operator/pkg/configfile"
+	"github.com/cmmarslender/web-operator/pkg/registry"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -53,7 +59,7 @@ func init() {
 func main() {
 	var configFile string
 	flag.StringVar(&configFile, "config", "",
-		"The controller will load its initial configuration from this file. "+
+		"The controller will load its initial configuration from this file, and reload the app settings when it changes. "+
 			"Omit this flag to use the default configuration values. "+
 			"Command-line flags override configuration from this file.")
 	opts := zap.Options{
@@ -66,7 +72,12 @@ func main() {
 
 	var err error
 	config := configv1.Config{}
-	options := ctrl.Options{Scheme: scheme}
+	options := ctrl.Options{
+		Scheme:    scheme,
+		NewClient: newClient,
+		// Secrets are read directly, so the manager doesn't cache every secret in the cluster
+		ClientDisableCacheFor: []client.Object{&corev1.Secret{}},
+	}
 	if configFile != "" {
 		options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile).OfKind(&config))
 		if err != nil {
@@ -81,14 +92,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Reload the app-level settings when the config file changes
+	var configWatcher *configfile.Watcher
+	if configFile != "" {
+		configWatcher, err = configfile.NewWatcher(configFile, scheme, &config)
+		if err != nil {
+			setupLog.Error(err, "unable to watch the config file")
+			os.Exit(1)
+		}
+		if err := mgr.Add(configWatcher); err != nil {
+			setupLog.Error(err, "unable to add the config file watcher")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.SimpleAppReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Config: &config,
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Config:        &config,
+		Recorder:      mgr.GetEventRecorderFor("simpleapp-controller"),
+		Registry:      registry.NewClient(),
+		ConfigWatcher: configWatcher,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SimpleApp")
 		os.Exit(1)
 	}
+	if err = (&controllers.SimpleAppTaskReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Config:        &config,
+		Recorder:      mgr.GetEventRecorderFor("simpleapptask-controller"),
+		ConfigWatcher: configWatcher,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SimpleAppTask")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -106,3 +144,19 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newClient returns a client that reads from the manager's cache, including unstructured objects
+// Apps and classes are read unstructured on every reconcile to tell unset fields from false and zero values
+func newClient(cache cache.Cache, config *rest.Config, options client.Options, uncachedObjects ...client.Object) (client.Client, error) {
+	c, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewDelegatingClient(client.NewDelegatingClientInput{
+		CacheReader:       cache,
+		Client:            c,
+		UncachedObjects:   uncachedObjects,
+		CacheUnstructured: true,
+	})
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	configv1 "github.com/cmmarslender/web-operator/apis/config/v1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DefaultInterval how often the config file is checked for changes
+const DefaultInterval = 10 * time.Second
+
+// Watcher reloads the operator config when its file changes, and sends an event for each reload
+// The file is polled rather than watched, so config maps mounted as volumes, which are updated through symlinks, are picked up
+// Only the app-level settings are reloaded. The manager's settings, such as the metrics address, need a restart
+type Watcher struct {
+	// Interval how often the file is checked for changes
+	Interval time.Duration
+
+	path     string
+	decoder  runtime.Decoder
+	current  atomic.Value
+	checksum [sha256.Size]byte
+	events   chan event.GenericEvent
+	log      logr.Logger
+}
+
+// NewWatcher returns a watcher for the config file at the path, starting from the config already loaded from it
+func NewWatcher(path string, scheme *runtime.Scheme, initial *configv1.Config) (*Watcher, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the config file: %w", err)
+	}
+
+	w := &Watcher{
+		Interval: DefaultInterval,
+		path:     path,
+		decoder:  serializer.NewCodecFactory(scheme).UniversalDecoder(),
+		checksum: sha256.Sum256(content),
+		events:   make(chan event.GenericEvent),
+		log:      ctrl.Log.WithName("configfile"),
+	}
+	w.current.Store(initial)
+
+	return w, nil
+}
+
+// Config returns the current config
+// The config is swapped as a whole on reload, so it must not be modified
+func (w *Watcher) Config() *configv1.Config {
+	return w.current.Load().(*configv1.Config)
+}
+
+// Source returns a source of an event for each reload of the config, for a controller to watch
+func (w *Watcher) Source() source.Source {
+	return &source.Channel{Source: w.events}
+}
+
+// Start checks the config file for changes until the context is done, implementing manager.Runnable
+func (w *Watcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			config, err := w.reload()
+			if err != nil {
+				w.log.Error(err, "unable to reload the config file, keeping the current config", "path", w.path)
+				continue
+			}
+			if config == nil {
+				continue
+			}
+
+			w.log.Info("reloaded the config file", "path", w.path)
+			select {
+			case w.events <- event.GenericEvent{Object: config}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// reload loads the config file and swaps in the new config, or returns nil if the file hasn't changed
+func (w *Watcher) reload() (*configv1.Config, error) {
+	content, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(content)
+	if checksum == w.checksum {
+		return nil, nil
+	}
+
+	config := &configv1.Config{}
+	if err := runtime.DecodeInto(w.decoder, content, config); err != nil {
+		return nil, err
+	}
+
+	w.checksum = checksum
+	w.current.Store(config)
+
+	return config, nil
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout how long a request to a registry may take, so a registry that stops responding doesn't block reconciles
+	DefaultTimeout = 30 * time.Second
+
+	// manifestMediaTypes are the manifest formats accepted when resolving digests, including multi-arch indexes
+	manifestMediaTypes = "application/vnd.oci.image.index.v1+json," +
+		"application/vnd.docker.distribution.manifest.list.v2+json," +
+		"application/vnd.oci.image.manifest.v1+json," +
+		"application/vnd.docker.distribution.manifest.v2+json"
+)
+
+var (
+	// challengeParamRegexp matches the parameters of a WWW-Authenticate challenge, such as realm="https://auth.example.com/token"
+	challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+	// nextLinkRegexp matches the link to the next page of tags
+	nextLinkRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// Client queries image registries
+// The interface allows the controller to be run against a stand-in registry
+type Client interface {
+	// Tags returns the tags of the image's repository
+	Tags(ctx context.Context, reference Reference, credentials *Credentials) ([]string, error)
+
+	// Digest returns the digest of the manifest the tag of the image's repository points to
+	Digest(ctx context.Context, reference Reference, tag string, credentials *Credentials) (string, error)
+}
+
+// HTTPClient queries registries with the Docker Registry HTTP API V2
+// Registries on localhost and loopback addresses are queried over plain HTTP, everything else over HTTPS
+type HTTPClient struct {
+	// HTTPClient the client requests are sent with
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the Docker Registry HTTP API V2, with requests limited to DefaultTimeout
+func NewClient() *HTTPClient {
+	return &HTTPClient{HTTPClient: &http.Client{Timeout: DefaultTimeout}}
+}
+
+// tagList is the response of the tags list endpoint
+type tagList struct {
+	Tags []string `json:"tags"`
+}
+
+// tokenResponse is the response of a bearer token endpoint
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// Tags returns the tags of the image's repository, following pagination
+func (c *HTTPClient) Tags(ctx context.Context, reference Reference, credentials *Credentials) ([]string, error) {
+	var tags []string
+
+	next := fmt.Sprintf("%s/v2/%s/tags/list", c.baseURL(reference.Registry), reference.Repository)
+	for next != "" {
+		response, err := c.do(ctx, http.MethodGet, next, "", credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		var list tagList
+		err = json.NewDecoder(response.Body).Decode(&list)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag list for %s: %w", reference.Name(), err)
+		}
+		tags = append(tags, list.Tags...)
+
+		next, err = nextLink(response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// Digest returns the digest of the manifest the tag points to
+// The digest is taken from the Docker-Content-Digest header, or computed from the manifest if the registry doesn't send it
+func (c *HTTPClient) Digest(ctx context.Context, reference Reference, tag string, credentials *Credentials) (string, error) {
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL(reference.Registry), reference.Repository, tag)
+
+	response, err := c.do(ctx, http.MethodHead, manifestURL, manifestMediaTypes, credentials)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if digest := response.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	response, err = c.do(ctx, http.MethodGet, manifestURL, manifestMediaTypes, credentials)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if digest := response.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	manifest, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)), nil
+}
+
+// do sends a request to the registry, authenticating with the challenge the registry responds with if needed
+// Responses other than 200 OK are returned as errors
+func (c *HTTPClient) do(ctx context.Context, method string, requestURL string, accept string, credentials *Credentials) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		drain(response)
+
+		if err := c.authorize(ctx, request, challenge, credentials); err != nil {
+			return nil, err
+		}
+
+		response, err = c.HTTPClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		drain(response)
+		return nil, fmt.Errorf("%s %s: unexpected status %s", method, requestURL, response.Status)
+	}
+
+	return response, nil
+}
+
+// authorize sets the authorization header of the request for the registry's challenge
+// Bearer challenges are answered with a token from the realm, using the credentials if there are any
+func (c *HTTPClient) authorize(ctx context.Context, request *http.Request, challenge string, credentials *Credentials) error {
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+
+	switch scheme {
+	case "basic":
+		if credentials == nil {
+			return fmt.Errorf("%s requires credentials", request.URL.Host)
+		}
+		request.SetBasicAuth(credentials.Username, credentials.Password)
+		return nil
+	case "bearer":
+		params := map[string]string{}
+		for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+			params[strings.ToLower(match[1])] = match[2]
+		}
+
+		token, err := c.token(ctx, params, credentials)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q from %s", challenge, request.URL.Host)
+	}
+}
+
+// token requests a bearer token from the realm of the challenge
+func (c *HTTPClient) token(ctx context.Context, params map[string]string, credentials *Credentials) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if credentials != nil {
+		request.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request to %s: unexpected status %s", realm.Host, response.Status)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response from %s: %w", realm.Host, err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("token response from %s has no token", realm.Host)
+}
+
+// baseURL returns the URL the registry's API is served from
+func (c *HTTPClient) baseURL(registry string) string {
+	host := apiHost(registry)
+	if plainHTTP(host) {
+		return "http://" + host
+	}
+
+	return "https://" + host
+}
+
+// plainHTTP returns whether the registry host is local, and so served over plain HTTP
+func plainHTTP(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	if hostname == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
+
+// nextLink returns the absolute URL of the next page from the response's Link header, or an empty string on the last page
+func nextLink(response *http.Response) (string, error) {
+	match := nextLinkRegexp.FindStringSubmatch(response.Header.Get("Link"))
+	if match == nil {
+		return "", nil
+	}
+
+	next, err := response.Request.URL.Parse(match[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid link to the next page of tags %q: %w", match[1], err)
+	}
+
+	return next.String(), nil
+}
+
+// drain discards the rest of the response body and closes it, so the connection can be reused
+func drain(response *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// testReference returns a reference to the repository on the test server, which is served over plain HTTP
+func testReference(t *testing.T, server *httptest.Server, repository string) Reference {
+	t.Helper()
+
+	reference, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/" + repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reference
+}
+
+func TestDigestFromHead(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.URL.Path != "/v2/org/app/manifests/1.2.3" {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+			t.Errorf("expected manifest media types in Accept, got %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	}))
+	defer server.Close()
+
+	digest, err := NewClient().Digest(context.Background(), testReference(t, server, "org/app"), "1.2.3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != testDigest {
+		t.Errorf("expected digest %s, got %s", testDigest, digest)
+	}
+	if len(methods) != 1 || methods[0] != http.MethodHead {
+		t.Errorf("expected a single HEAD request, got %v", methods)
+	}
+}
+
+func TestDigestFromGetManifest(t *testing.T) {
+	manifest := `{"schemaVersion":2}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(manifest))
+		}
+	}))
+	defer server.Close()
+
+	digest, err := NewClient().Digest(context.Background(), testReference(t, server, "org/app"), "latest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+	if digest != expected {
+		t.Errorf("expected the digest computed from the manifest %s, got %s", expected, digest)
+	}
+}
+
+func TestDigestNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewClient().Digest(context.Background(), testReference(t, server, "org/app"), "missing", nil)
+	if err == nil {
+		t.Error("expected an error for a missing tag")
+	}
+}
+
+func TestTagsWithBearerAuthAndPagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:org/app:pull" || r.URL.Query().Get("service") != "test" {
+				t.Errorf("unexpected token query %s", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode(tokenResponse{Token: "abc"})
+		case "/v2/org/app/tags/list":
+			if r.Header.Get("Authorization") != "Bearer abc" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:org/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/org/app/tags/list?n=2&last=1.1.0>; rel="next"`)
+				_ = json.NewEncoder(w).Encode(tagList{Tags: []string{"1.0.0", "1.1.0"}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(tagList{Tags: []string{"2.0.0"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tags, err := NewClient().Tags(context.Background(), testReference(t, server, "org/app"), &Credentials{Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tags, ",") != "1.0.0,1.1.0,2.0.0" {
+		t.Errorf("expected the tags of both pages, got %v", tags)
+	}
+}
+
+func TestDigestWithBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	}))
+	defer server.Close()
+
+	reference := testReference(t, server, "org/app")
+
+	digest, err := NewClient().Digest(context.Background(), reference, "1.0.0", &Credentials{Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != testDigest {
+		t.Errorf("expected digest %s, got %s", testDigest, digest)
+	}
+
+	if _, err := NewClient().Digest(context.Background(), reference, "1.0.0", nil); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := &HTTPClient{HTTPClient: &http.Client{Timeout: 50 * time.Millisecond}}
+	if _, err := client.Digest(context.Background(), testReference(t, server, "org/app"), "1.0.0", nil); err == nil {
+		t.Error("expected an error when the registry doesn't respond")
+	}
+}
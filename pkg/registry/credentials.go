@@ -0,0 +1,91 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Credentials authenticate requests to a registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// dockerConfig is the format of .dockerconfigjson secrets, and of the auths in .dockercfg secrets
+type dockerConfig struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// dockerConfigEntry holds the credentials for a registry in a docker config
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// CredentialsFromDockerConfig returns the credentials for the registry from a .dockerconfigjson or .dockercfg secret,
+// or nil if the config has none for the registry
+func CredentialsFromDockerConfig(data []byte, registry string) (*Credentials, error) {
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid docker config: %w", err)
+	}
+
+	// .dockercfg secrets hold the auths without the wrapping object
+	if config.Auths == nil {
+		if err := json.Unmarshal(data, &config.Auths); err != nil {
+			return nil, fmt.Errorf("invalid docker config: %w", err)
+		}
+	}
+
+	for server, entry := range config.Auths {
+		if !matchesRegistry(server, registry) {
+			continue
+		}
+
+		if entry.Auth == "" {
+			return &Credentials{Username: entry.Username, Password: entry.Password}, nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth for %s in docker config: %w", server, err)
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid auth for %s in docker config", server)
+		}
+
+		return &Credentials{Username: parts[0], Password: parts[1]}, nil
+	}
+
+	return nil, nil
+}
+
+// matchesRegistry returns whether a server in a docker config, such as https://index.docker.io/v1/, is the registry
+func matchesRegistry(server string, registry string) bool {
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+
+	return apiHost(server) == apiHost(registry)
+}
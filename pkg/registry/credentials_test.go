@@ -0,0 +1,60 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestCredentialsFromDockerConfig(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pass:word"))
+	dockerConfigJSON := []byte(`{"auths":{
+		"https://index.docker.io/v1/":{"auth":"` + auth + `"},
+		"ghcr.io":{"username":"ghcr-user","password":"ghcr-token"}
+	}}`)
+	dockerCfg := []byte(`{"quay.io":{"auth":"` + auth + `"}}`)
+
+	tests := []struct {
+		data     []byte
+		registry string
+		expected *Credentials
+	}{
+		{dockerConfigJSON, "docker.io", &Credentials{Username: "user", Password: "pass:word"}},
+		{dockerConfigJSON, "ghcr.io", &Credentials{Username: "ghcr-user", Password: "ghcr-token"}},
+		{dockerConfigJSON, "quay.io", nil},
+		{dockerCfg, "quay.io", &Credentials{Username: "user", Password: "pass:word"}},
+	}
+
+	for _, test := range tests {
+		credentials, err := CredentialsFromDockerConfig(test.data, test.registry)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.registry, err)
+			continue
+		}
+
+		if (credentials == nil) != (test.expected == nil) || (credentials != nil && *credentials != *test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.registry, test.expected, credentials)
+		}
+	}
+
+	for _, data := range []string{`not json`, `{"auths":{"ghcr.io":{"auth":"not base64"}}}`, `{"auths":{"ghcr.io":{"auth":"dXNlcg=="}}}`} {
+		if _, err := CredentialsFromDockerConfig([]byte(data), "ghcr.io"); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultRegistry the registry of images without a registry host, such as nginx or library/nginx
+	DefaultRegistry = "docker.io"
+
+	// defaultRegistryHost the host the API of the default registry is served from
+	defaultRegistryHost = "registry-1.docker.io"
+)
+
+// Reference is a parsed image reference, such as ghcr.io/org/app:1.2.3
+type Reference struct {
+	// Registry the registry host, such as ghcr.io or localhost:5000
+	Registry string
+
+	// Repository the repository within the registry, such as org/app
+	Repository string
+
+	// Tag the tag of the image, if any
+	Tag string
+
+	// Digest the digest of the image, if any
+	Digest string
+
+	// name the image name as written, without the tag or digest
+	name string
+}
+
+// ParseReference parses an image reference, defaulting to Docker Hub for images without a registry host
+func ParseReference(image string) (Reference, error) {
+	var reference Reference
+
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, reference.Digest = name[:i], name[i+1:]
+	}
+
+	// A colon after the last slash separates the tag, otherwise it's the port of the registry host
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference.Tag = name[:i], name[i+1:]
+	}
+
+	if name == "" {
+		return Reference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+	reference.name = name
+
+	reference.Registry = DefaultRegistry
+	reference.Repository = name
+	if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+		reference.Registry, reference.Repository = name[:i], name[i+1:]
+	}
+
+	if reference.Registry == DefaultRegistry && !strings.Contains(reference.Repository, "/") {
+		reference.Repository = "library/" + reference.Repository
+	}
+
+	if reference.Repository == "" {
+		return Reference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+
+	return reference, nil
+}
+
+// Name returns the image name as written, without the tag or digest, such as ghcr.io/org/app
+func (r Reference) Name() string {
+	if r.name != "" {
+		return r.name
+	}
+
+	return fmt.Sprintf("%s/%s", r.Registry, r.Repository)
+}
+
+// SameRepository returns whether both references are to the same repository, however they are written
+func (r Reference) SameRepository(other Reference) bool {
+	return apiHost(r.Registry) == apiHost(other.Registry) && r.Repository == other.Repository
+}
+
+// WithTag returns the image name with the given tag, such as ghcr.io/org/app:1.2.3
+func (r Reference) WithTag(tag string) string {
+	return fmt.Sprintf("%s:%s", r.Name(), tag)
+}
+
+// WithDigest returns the image name with the given digest, such as ghcr.io/org/app@sha256:...
+func (r Reference) WithDigest(digest string) string {
+	return fmt.Sprintf("%s@%s", r.Name(), digest)
+}
+
+// String returns the full image reference
+func (r Reference) String() string {
+	image := r.Name()
+	if r.Tag != "" {
+		image = fmt.Sprintf("%s:%s", image, r.Tag)
+	}
+	if r.Digest != "" {
+		image = fmt.Sprintf("%s@%s", image, r.Digest)
+	}
+
+	return image
+}
+
+// InRegistry returns whether the image is in the registry, such as "ghcr.io",
+// or in a path of the registry if it has one, such as "ghcr.io/org"
+func (r Reference) InRegistry(registry string) bool {
+	parts := strings.SplitN(strings.TrimSuffix(registry, "/"), "/", 2)
+	if apiHost(parts[0]) != apiHost(r.Registry) {
+		return false
+	}
+
+	return len(parts) == 1 || r.Repository == parts[1] || strings.HasPrefix(r.Repository, parts[1]+"/")
+}
+
+// Mirror returns the image pulled from the mirror instead, if the image is in the registry (or path of the registry)
+// The rest of the repository, the tag and the digest are kept
+func (r Reference) Mirror(registry string, mirror string) (string, bool) {
+	if !r.InRegistry(registry) {
+		return "", false
+	}
+
+	repository := r.Repository
+	if parts := strings.SplitN(strings.TrimSuffix(registry, "/"), "/", 2); len(parts) == 2 {
+		repository = strings.TrimPrefix(strings.TrimPrefix(repository, parts[1]), "/")
+	}
+
+	mirrored := Reference{Tag: r.Tag, Digest: r.Digest, name: strings.TrimSuffix(mirror, "/")}
+	if repository != "" {
+		mirrored.name = fmt.Sprintf("%s/%s", mirrored.name, repository)
+	}
+
+	return mirrored.String(), true
+}
+
+// isRegistryHost returns whether the first component of an image name is a registry host rather than part of the repository
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+// apiHost returns the host the registry's API is served from
+func apiHost(registry string) string {
+	if registry == DefaultRegistry || registry == "index.docker.io" {
+		return defaultRegistryHost
+	}
+
+	return registry
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image     string
+		expected  Reference
+		name      string
+		stringRef string
+	}{
+		{
+			image:    "nginx",
+			expected: Reference{Registry: "docker.io", Repository: "library/nginx"},
+			name:     "nginx",
+		},
+		{
+			image:    "nginx:1.21",
+			expected: Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.21"},
+			name:     "nginx",
+		},
+		{
+			image:    "org/app:latest",
+			expected: Reference{Registry: "docker.io", Repository: "org/app", Tag: "latest"},
+			name:     "org/app",
+		},
+		{
+			image:    "ghcr.io/org/app:1.2.3@sha256:abc",
+			expected: Reference{Registry: "ghcr.io", Repository: "org/app", Tag: "1.2.3", Digest: "sha256:abc"},
+			name:     "ghcr.io/org/app",
+		},
+		{
+			image:    "localhost:5000/app",
+			expected: Reference{Registry: "localhost:5000", Repository: "app"},
+			name:     "localhost:5000/app",
+		},
+		{
+			image:    "localhost/app:dev",
+			expected: Reference{Registry: "localhost", Repository: "app", Tag: "dev"},
+			name:     "localhost/app",
+		},
+	}
+
+	for _, test := range tests {
+		reference, err := ParseReference(test.image)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.image, err)
+			continue
+		}
+
+		if reference.Registry != test.expected.Registry || reference.Repository != test.expected.Repository ||
+			reference.Tag != test.expected.Tag || reference.Digest != test.expected.Digest {
+			t.Errorf("%s: expected %+v, got %+v", test.image, test.expected, reference)
+		}
+		if reference.Name() != test.name {
+			t.Errorf("%s: expected name %s, got %s", test.image, test.name, reference.Name())
+		}
+		if reference.String() != test.image {
+			t.Errorf("%s: expected string %s, got %s", test.image, test.image, reference.String())
+		}
+	}
+
+	for _, image := range []string{"", ":tag", "@sha256:abc"} {
+		if _, err := ParseReference(image); err == nil {
+			t.Errorf("%q: expected an error", image)
+		}
+	}
+}
+
+func TestInRegistry(t *testing.T) {
+	tests := []struct {
+		image    string
+		registry string
+		expected bool
+	}{
+		{"nginx", "docker.io", true},
+		{"nginx", "index.docker.io", true},
+		{"nginx", "docker.io/library", true},
+		{"org/app", "docker.io/library", false},
+		{"ghcr.io/org/app", "ghcr.io", true},
+		{"ghcr.io/org/app", "ghcr.io/org", true},
+		{"ghcr.io/org/app", "ghcr.io/org/", true},
+		{"ghcr.io/org2/app", "ghcr.io/org", false},
+		{"ghcr.io/organisation/app", "ghcr.io/org", false},
+		{"ghcr.io/org/app", "quay.io", false},
+	}
+
+	for _, test := range tests {
+		reference, err := ParseReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reference.InRegistry(test.registry) != test.expected {
+			t.Errorf("%s in %s: expected %t", test.image, test.registry, test.expected)
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	tests := []struct {
+		image    string
+		registry string
+		mirror   string
+		expected string
+	}{
+		{"nginx:1.21", "docker.io", "mirror.example.com/dockerhub", "mirror.example.com/dockerhub/library/nginx:1.21"},
+		{"org/app", "docker.io", "mirror.example.com/dockerhub/", "mirror.example.com/dockerhub/org/app"},
+		{"ghcr.io/org/app@sha256:abc", "ghcr.io/org", "mirror.example.com", "mirror.example.com/app@sha256:abc"},
+		{"ghcr.io/org/app:1.0", "ghcr.io/org/app", "mirror.example.com/app", "mirror.example.com/app:1.0"},
+		{"ghcr.io/org2/app", "ghcr.io/org", "mirror.example.com", ""},
+	}
+
+	for _, test := range tests {
+		reference, err := ParseReference(test.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mirrored, ok := reference.Mirror(test.registry, test.mirror)
+		if ok != (test.expected != "") || mirrored != test.expected {
+			t.Errorf("%s mirrored from %s to %s: expected %q, got %q", test.image, test.registry, test.mirror, test.expected, mirrored)
+		}
+	}
+}
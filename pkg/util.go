@@ -1,6 +1,8 @@
 package util
 
 import (
+	"time"
+
 	"github.com/banzaicloud/operator-tools/pkg/reconciler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -23,3 +25,12 @@ func ReconcilerStateHelper(enabled bool) reconciler.DesiredState {
 
 	return reconciler.StateAbsent
 }
+
+// RequeueAfterHelper Returns the sooner of two requeue delays, where zero means no requeue
+func RequeueAfterHelper(current time.Duration, next time.Duration) time.Duration {
+	if current == 0 || (next > 0 && next < current) {
+		return next
+	}
+
+	return current
+}